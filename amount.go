@@ -0,0 +1,46 @@
+package swish
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseAmount parses a Swish amount like "100" or "100.50" into öre.
+func parseAmount(amount string) (int64, error) {
+	whole, fraction, _ := strings.Cut(amount, ".")
+
+	if whole == "" || len(fraction) > 2 || strings.HasPrefix(whole, "-") || strings.HasPrefix(whole, "+") {
+		return 0, fmt.Errorf("Invalid amount: %q", amount)
+	}
+
+	kronor, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid amount: %q", amount)
+	}
+
+	var ore int64
+	if fraction != "" {
+		ore, err = strconv.ParseInt(fraction, 10, 64)
+		if err != nil || strings.HasPrefix(fraction, "-") || strings.HasPrefix(fraction, "+") {
+			return 0, fmt.Errorf("Invalid amount: %q", amount)
+		}
+
+		if len(fraction) == 1 {
+			ore *= 10
+		}
+	}
+
+	return kronor*100 + ore, nil
+}
+
+// formatAmount formats the given öre as a Swish amount like "100.50".
+func formatAmount(ore int64) string {
+	sign := ""
+	if ore < 0 {
+		sign = "-"
+		ore = -ore
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, ore/100, ore%100)
+}
@@ -0,0 +1,35 @@
+package swish
+
+import (
+	"testing"
+
+	"github.com/frozzare/go-assert"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		expected int64
+		valid    bool
+	}{
+		{"100", 10000, true},
+		{"100.5", 10050, true},
+		{"100.05", 10005, true},
+		{"0.99", 99, true},
+		{"100.055", 0, false},
+		{"-1", 0, false},
+		{"1.-5", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		ore, err := parseAmount(test.amount)
+
+		assert.Equal(t, test.expected, ore, test.amount)
+		assert.Equal(t, test.valid, err == nil, test.amount)
+	}
+
+	assert.Equal(t, "100.05", formatAmount(10005))
+	assert.Equal(t, "-0.50", formatAmount(-50))
+}
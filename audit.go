@@ -0,0 +1,314 @@
+package swish
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrAuditChainBroken is the error when an audit log's hash chain does not match its records.
+	ErrAuditChainBroken = errors.New("Error: Audit log hash chain is broken")
+
+	// redactedFields is the payload fields that are replaced before a payload is audited.
+	redactedFields = map[string]bool{
+		"payerAlias": true,
+		"payerSSN":   true,
+	}
+)
+
+// AuditRecord represents a request to or a callback from the Swish API.
+type AuditRecord struct {
+	Time          time.Time       `json:"time"`
+	Method        string          `json:"method"`
+	Endpoint      string          `json:"endpoint"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Tenant        string          `json:"tenant,omitempty"`
+	InstructionID string          `json:"instructionId,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	StatusCode    int             `json:"statusCode,omitempty"`
+	Status        string          `json:"status,omitempty"`
+	ErrorCodes    []string        `json:"errorCodes,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Latency       time.Duration   `json:"latency"`
+	PreviousHash  string          `json:"previousHash,omitempty"`
+	Hash          string          `json:"hash,omitempty"`
+}
+
+// AuditSink represents a destination for audit records.
+type AuditSink interface {
+	Audit(ctx context.Context, record *AuditRecord) error
+}
+
+// FileAuditSink represents an audit sink that appends records as JSON lines to a file.
+type FileAuditSink struct {
+	path      string
+	maxSize   int64
+	hashChain bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	lastHash string
+}
+
+// NewFileAuditSink creates a new file audit sink that appends to the given file. When maxSize
+// is greater than zero the file is rotated when it would grow beyond maxSize bytes. When
+// hashChain is true each record contains the hash of the previous record, so removed or
+// changed records can be detected with VerifyAuditLog.
+func NewFileAuditSink(path string, maxSize int64, hashChain bool) (*FileAuditSink, error) {
+	s := &FileAuditSink{
+		path:      path,
+		maxSize:   maxSize,
+		hashChain: hashChain,
+	}
+
+	if hashChain {
+		lastHash, err := readLastHash(path)
+		if err != nil {
+			return nil, err
+		}
+
+		s.lastHash = lastHash
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Audit appends the record to the file.
+func (s *FileAuditSink) Audit(ctx context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := *record
+
+	if s.hashChain {
+		r.PreviousHash = s.lastHash
+		r.Hash = ""
+
+		hash, err := hashRecord(&r)
+		if err != nil {
+			return err
+		}
+
+		r.Hash = hash
+	}
+
+	line, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+
+	if err != nil {
+		return err
+	}
+
+	s.lastHash = r.Hash
+
+	return nil
+}
+
+// Close closes the file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// open opens the file for appending.
+func (s *FileAuditSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+// rotate renames the current file with a timestamp suffix and opens a new file.
+// The hash chain continues in the new file.
+func (s *FileAuditSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", s.path, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(s.path, rotated); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+// VerifyAuditLog verifies the hash chain of an audit log written by a file audit sink.
+// Rotated files are verified in order by passing the previous file's last hash.
+func VerifyAuditLog(r io.Reader, previousHash string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var record AuditRecord
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return "", err
+		}
+
+		if record.PreviousHash != previousHash {
+			return "", ErrAuditChainBroken
+		}
+
+		hash := record.Hash
+		record.Hash = ""
+
+		expected, err := hashRecord(&record)
+		if err != nil {
+			return "", err
+		}
+
+		if hash != expected {
+			return "", ErrAuditChainBroken
+		}
+
+		previousHash = hash
+	}
+
+	return previousHash, scanner.Err()
+}
+
+// audit writes the given record, completed with the response and error, to the audit sink.
+// Failures are logged since the request has already been sent to Swish.
+func (s *Client) audit(ctx context.Context, record *AuditRecord, res *http.Response, err error) {
+	if res != nil {
+		record.StatusCode = res.StatusCode
+		record.InstructionID = path.Base(res.Header.Get("Location"))
+	}
+
+	if record.InstructionID == "" || record.InstructionID == "." {
+		record.InstructionID = instructionID(record.Endpoint)
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	record.CorrelationID = CorrelationID(ctx)
+	record.Tenant = Tenant(ctx)
+
+	if err := s.Audit.Audit(ctx, record); err != nil {
+		logf(ctx, "failed to write audit record: %s", err)
+	}
+}
+
+// instructionID returns the id from an endpoint like /paymentrequests/{id}.
+func instructionID(endpoint string) string {
+	parts := strings.Split(strings.Trim(endpoint, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// redactPayload returns the given JSON payload with personal data replaced.
+func redactPayload(payload []byte) json.RawMessage {
+	if payload == nil {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil
+	}
+
+	for field := range fields {
+		if redactedFields[field] {
+			fields[field] = "REDACTED"
+		}
+	}
+
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+
+	return redacted
+}
+
+// hashRecord returns the hex encoded SHA-256 hash of the given record.
+func hashRecord(record *AuditRecord) (string, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// readLastHash returns the hash of the last record in the given file, if it exists.
+func readLastHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	var lastHash string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var record AuditRecord
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return "", err
+		}
+
+		lastHash = record.Hash
+	}
+
+	return lastHash, scanner.Err()
+}
@@ -0,0 +1,116 @@
+package swish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestFileAuditSink(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	sink, err := NewFileAuditSink(file, 0, true)
+	assert.Nil(t, err)
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Audit:      sink,
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	})
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(422, `[{"errorCode":"RF02","errorMessage":"Original Payment not found"}]`), nil
+	})
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		PayerAlias: "46701234567",
+		PayeeAlias: "1231181189",
+		Amount:     "100",
+	})
+	assert.Nil(t, err)
+
+	_, err = client.CreateRefundRequest(context.Background(), &PaymentRequest{
+		PayerAlias: "1231181189",
+		Amount:     "100",
+	})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, sink.Close())
+
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var created, refund AuditRecord
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &created))
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &refund))
+
+	assert.Equal(t, "/paymentrequests", created.Endpoint)
+	assert.Equal(t, "AB23D7406ECE4542A80152D909EF9F6B", created.InstructionID)
+	assert.Equal(t, 201, created.StatusCode)
+	assert.Equal(t, `{"amount":"100","payeeAlias":"1231181189","payerAlias":"REDACTED"}`, string(created.Payload))
+	assert.Equal(t, "", created.PreviousHash)
+
+	assert.Equal(t, 422, refund.StatusCode)
+	assert.Equal(t, []string{"RF02"}, refund.ErrorCodes)
+	assert.Equal(t, "Original Payment not found", refund.Error)
+	assert.Equal(t, created.Hash, refund.PreviousHash)
+
+	last, err := VerifyAuditLog(bytes.NewReader(data), "")
+	assert.Nil(t, err)
+	assert.Equal(t, refund.Hash, last)
+
+	tampered := bytes.Replace(data, []byte(`"amount":"100"`), []byte(`"amount":"200"`), 1)
+	_, err = VerifyAuditLog(bytes.NewReader(tampered), "")
+	assert.Equal(t, ErrAuditChainBroken, err)
+
+	// The chain continues when the file is opened again.
+	sink, err = NewFileAuditSink(file, 0, true)
+	assert.Nil(t, err)
+	assert.Equal(t, refund.Hash, sink.lastHash)
+	assert.Nil(t, sink.Close())
+}
+
+func TestFileAuditSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "audit.jsonl")
+
+	sink, err := NewFileAuditSink(file, 100, false)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, sink.Audit(context.Background(), &AuditRecord{Method: "GET", Endpoint: "/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B"}))
+	}
+
+	assert.Nil(t, sink.Close())
+
+	files, err := filepath.Glob(file + "*")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+}
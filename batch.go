@@ -0,0 +1,365 @@
+package swish
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of refund instructions in batch results.
+const (
+	BatchStatusCreated = "CREATED"
+	BatchStatusInvalid = "INVALID"
+	BatchStatusFailed  = "FAILED"
+)
+
+var (
+	// ErrInvalidInstructionUUID is the error when a refund instruction has no valid instruction UUID.
+	ErrInvalidInstructionUUID = errors.New("Error: Instruction UUID must be 32 hexadecimal characters")
+
+	// ErrDuplicateInstructionUUID is the error when a batch has the same instruction UUID more than once.
+	ErrDuplicateInstructionUUID = errors.New("Error: Duplicate instruction UUID in batch")
+
+	// ErrNoOriginalPaymentReference is the error when a refund instruction has no original payment reference.
+	ErrNoOriginalPaymentReference = errors.New("Error: Original payment reference is required")
+
+	// ErrInvalidAmount is the error when a refund instruction has no positive amount.
+	ErrInvalidAmount = errors.New("Error: Amount must be a positive amount, like 100.00")
+
+	// ErrUnknownBatchFormat is the error when reading refund instructions in an unknown format.
+	ErrUnknownBatchFormat = errors.New("Error: Unknown batch format, use csv or jsonl")
+)
+
+// instructionUUID matches instruction UUIDs, 32 hexadecimal characters as used by Swish API.
+var instructionUUID = regexp.MustCompile(`^[0-9A-Fa-f]{32}$`)
+
+// RefundInstruction represents a refund in a batch.
+type RefundInstruction struct {
+	// Row is the row of the instruction in the file it was read from, starting at 1.
+	Row int `json:"-"`
+
+	InstructionUUID          string `json:"instructionUUID"`
+	OriginalPaymentReference string `json:"originalPaymentReference"`
+	PayerPaymentReference    string `json:"payerPaymentReference,omitempty"`
+	PayerAlias               string `json:"payerAlias,omitempty"`
+	Amount                   string `json:"amount"`
+	Currency                 string `json:"currency,omitempty"`
+	Message                  string `json:"message,omitempty"`
+	CallbackURL              string `json:"callbackUrl,omitempty"`
+}
+
+// Validate returns an error if the refund instruction can not be sent to Swish API.
+func (i *RefundInstruction) Validate() error {
+	if !instructionUUID.MatchString(i.InstructionUUID) {
+		return ErrInvalidInstructionUUID
+	}
+
+	if i.OriginalPaymentReference == "" {
+		return ErrNoOriginalPaymentReference
+	}
+
+	if amount, err := parseAmount(i.Amount); err != nil || amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return nil
+}
+
+// refund returns the refund request for the instruction.
+func (i *RefundInstruction) refund() *PaymentRequest {
+	return &PaymentRequest{
+		OriginalPaymentReference: i.OriginalPaymentReference,
+		PayerPaymentReference:    i.PayerPaymentReference,
+		PayerAlias:               i.PayerAlias,
+		Amount:                   i.Amount,
+		Currency:                 i.Currency,
+		Message:                  i.Message,
+		CallbackURL:              i.CallbackURL,
+	}
+}
+
+// RefundResult represents the result of a refund instruction in a batch.
+type RefundResult struct {
+	Row             int       `json:"row"`
+	InstructionUUID string    `json:"instructionUUID"`
+	ID              string    `json:"id,omitempty"`
+	Status          string    `json:"status"`
+	ErrorCodes      []string  `json:"errorCodes,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+// ReadRefundInstructions reads refund instructions in the given format, csv or jsonl.
+//
+// CSV files must start with a header row with the JSON names of the instruction's fields,
+// like instructionUUID, originalPaymentReference and amount. JSONL files have one JSON
+// object per line and empty lines are ignored.
+func ReadRefundInstructions(r io.Reader, format string) ([]*RefundInstruction, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return readRefundInstructionsCSV(r)
+	case "jsonl":
+		return readRefundInstructionsJSONL(r)
+	default:
+		return nil, ErrUnknownBatchFormat
+	}
+}
+
+// readRefundInstructionsCSV reads refund instructions from CSV with a header row.
+func readRefundInstructionsCSV(r io.Reader) ([]*RefundInstruction, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var instructions []*RefundInstruction
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return instructions, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]string, len(header))
+		for i, name := range header {
+			values[strings.TrimSpace(name)] = strings.TrimSpace(record[i])
+		}
+
+		instructions = append(instructions, &RefundInstruction{
+			Row:                      row,
+			InstructionUUID:          values["instructionUUID"],
+			OriginalPaymentReference: values["originalPaymentReference"],
+			PayerPaymentReference:    values["payerPaymentReference"],
+			PayerAlias:               values["payerAlias"],
+			Amount:                   values["amount"],
+			Currency:                 values["currency"],
+			Message:                  values["message"],
+			CallbackURL:              values["callbackUrl"],
+		})
+	}
+}
+
+// readRefundInstructionsJSONL reads refund instructions from JSON lines.
+func readRefundInstructionsJSONL(r io.Reader) ([]*RefundInstruction, error) {
+	scanner := bufio.NewScanner(r)
+
+	var instructions []*RefundInstruction
+	for row := 1; scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		instruction := &RefundInstruction{Row: row}
+		if err := json.Unmarshal([]byte(line), instruction); err != nil {
+			return nil, fmt.Errorf("Invalid refund instruction on row %d: %s", row, err)
+		}
+
+		instructions = append(instructions, instruction)
+	}
+
+	return instructions, scanner.Err()
+}
+
+// ReadRefundResults reads refund results written as JSON lines, like a results file from
+// an earlier batch that should be resumed.
+func ReadRefundResults(r io.Reader) ([]*RefundResult, error) {
+	scanner := bufio.NewScanner(r)
+
+	var results []*RefundResult
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var result *RefundResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			// The last line can be incomplete if the batch was interrupted while writing it.
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	return results, scanner.Err()
+}
+
+// RefundBatch represents a batch of refunds sent with bounded concurrency and rate.
+//
+// The instruction UUID identifies each refund across runs. Refunds are always created with
+// APIVersion2 and the instruction UUID, whatever the client's API version, so sending a refund
+// again does not refund twice. Instructions that are completed are skipped and a refund that
+// was sent but interrupted before its result was reported is sent again with the same
+// instruction UUID, so an interrupted batch is resumed by running it again with the completed
+// instruction UUIDs from its results.
+type RefundBatch struct {
+	Client *Client
+
+	// Concurrency is the maximum number of refunds sent at the same time, 1 when zero.
+	Concurrency int
+	// Interval is the minimum time between sending two refunds, no limit when zero.
+	Interval time.Duration
+	// Completed is the instruction UUIDs of refunds that already are created.
+	Completed map[string]bool
+}
+
+// Complete marks the instruction UUIDs of the created refunds in the given results as completed.
+func (b *RefundBatch) Complete(results []*RefundResult) {
+	if b.Completed == nil {
+		b.Completed = make(map[string]bool)
+	}
+
+	for _, result := range results {
+		if result.Status == BatchStatusCreated {
+			b.Completed[strings.ToUpper(result.InstructionUUID)] = true
+		}
+	}
+}
+
+// Run validates the instructions and creates the refunds that are not completed. The result
+// of each instruction that is not skipped is passed to fn, one at a time. Invalid instructions
+// are reported without being sent. Run stops when the context is done or fn returns an error.
+func (b *RefundBatch) Run(ctx context.Context, instructions []*RefundInstruction, fn func(*RefundResult) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var tick <-chan time.Time
+	if b.Interval > 0 {
+		ticker := time.NewTicker(b.Interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		first error
+	)
+
+	report := func(result *RefundResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if first != nil {
+			return
+		}
+
+		result.Time = time.Now()
+
+		if err := fn(result); err != nil {
+			first = err
+			cancel()
+		}
+	}
+
+	sem := make(chan struct{}, concurrency)
+	seen := make(map[string]bool, len(instructions))
+	sent := false
+
+	for _, instruction := range instructions {
+		id := strings.ToUpper(instruction.InstructionUUID)
+		if b.Completed[id] {
+			continue
+		}
+
+		result := &RefundResult{
+			Row:             instruction.Row,
+			InstructionUUID: instruction.InstructionUUID,
+		}
+
+		err := instruction.Validate()
+		if err == nil && seen[id] {
+			err = ErrDuplicateInstructionUUID
+		}
+
+		seen[id] = true
+
+		if err != nil {
+			result.Status = BatchStatusInvalid
+			result.Error = err.Error()
+			report(result)
+			continue
+		}
+
+		if tick != nil && sent {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		sent = true
+		wg.Add(1)
+
+		go func(instruction *RefundInstruction, result *RefundResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var errorCodes []string
+
+			req := instruction.refund()
+			req.ID = strings.ToUpper(instruction.InstructionUUID)
+
+			refund, err := b.Client.createRefundRequest(withErrorCodes(ctx, &errorCodes), APIVersion2, req)
+			if err != nil {
+				if ctx.Err() != nil {
+					// Interrupted, the refund is sent again when the batch is resumed.
+					return
+				}
+
+				result.Status = BatchStatusFailed
+				result.ErrorCodes = errorCodes
+				result.Error = err.Error()
+			} else {
+				result.Status = BatchStatusCreated
+				result.ID = refund.ID
+			}
+
+			report(result)
+		}(instruction, result)
+	}
+
+	wg.Wait()
+
+	if first != nil {
+		return first
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,216 @@
+package swish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestReadRefundInstructions(t *testing.T) {
+	tests := []struct {
+		description string
+		format      string
+		input       string
+		expected    []*RefundInstruction
+		err         error
+	}{
+		{
+			description: "csv",
+			format:      "csv",
+			input:       "instructionUUID,originalPaymentReference,amount,message\nA1B2C3D4E5F60718293A4B5C6D7E8F90, ref1 ,100.00,Refund\n",
+			expected: []*RefundInstruction{
+				{Row: 1, InstructionUUID: "A1B2C3D4E5F60718293A4B5C6D7E8F90", OriginalPaymentReference: "ref1", Amount: "100.00", Message: "Refund"},
+			},
+		},
+		{
+			description: "jsonl",
+			format:      "JSONL",
+			input:       "{\"instructionUUID\":\"A1B2C3D4E5F60718293A4B5C6D7E8F90\",\"originalPaymentReference\":\"ref1\",\"amount\":\"1\"}\n\n{\"instructionUUID\":\"B1B2C3D4E5F60718293A4B5C6D7E8F90\",\"amount\":\"2\"}\n",
+			expected: []*RefundInstruction{
+				{Row: 1, InstructionUUID: "A1B2C3D4E5F60718293A4B5C6D7E8F90", OriginalPaymentReference: "ref1", Amount: "1"},
+				{Row: 3, InstructionUUID: "B1B2C3D4E5F60718293A4B5C6D7E8F90", Amount: "2"},
+			},
+		},
+		{
+			description: "unknown format",
+			format:      "xml",
+			err:         ErrUnknownBatchFormat,
+		},
+	}
+
+	for _, test := range tests {
+		instructions, err := ReadRefundInstructions(strings.NewReader(test.input), test.format)
+		assert.Equal(t, test.err, err, test.description)
+		assert.Equal(t, test.expected, instructions, test.description)
+	}
+}
+
+func TestRefundInstructionValidate(t *testing.T) {
+	tests := []struct {
+		description string
+		instruction *RefundInstruction
+		err         error
+	}{
+		{"valid", &RefundInstruction{InstructionUUID: "A1B2C3D4E5F60718293A4B5C6D7E8F90", OriginalPaymentReference: "ref", Amount: "1.50"}, nil},
+		{"invalid uuid", &RefundInstruction{InstructionUUID: "A1B2", OriginalPaymentReference: "ref", Amount: "1"}, ErrInvalidInstructionUUID},
+		{"no reference", &RefundInstruction{InstructionUUID: "A1B2C3D4E5F60718293A4B5C6D7E8F90", Amount: "1"}, ErrNoOriginalPaymentReference},
+		{"zero amount", &RefundInstruction{InstructionUUID: "A1B2C3D4E5F60718293A4B5C6D7E8F90", OriginalPaymentReference: "ref", Amount: "0"}, ErrInvalidAmount},
+		{"invalid amount", &RefundInstruction{InstructionUUID: "A1B2C3D4E5F60718293A4B5C6D7E8F90", OriginalPaymentReference: "ref", Amount: "abc"}, ErrInvalidAmount},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.err, test.instruction.Validate(), test.description)
+	}
+}
+
+func TestRefundBatch(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+	assert.Nil(t, err)
+
+	var mu sync.Mutex
+	var sent []string
+
+	// Refunds are created with v2 whatever the client's API version.
+	httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "PUT" || !strings.HasPrefix(req.URL.String(), "https://mss.cpc.getswish.net/swish-cpcapi/api/v2/refunds/") {
+			return nil, errors.New("unexpected request " + req.Method + " " + req.URL.String())
+		}
+
+		var refund *PaymentRequest
+		json.NewDecoder(req.Body).Decode(&refund)
+
+		mu.Lock()
+		sent = append(sent, refund.OriginalPaymentReference)
+		mu.Unlock()
+
+		if refund.OriginalPaymentReference == "missing" {
+			return httpmock.NewStringResponse(422, `[{"errorCode":"RF02","errorMessage":"Original Payment not found"}]`), nil
+		}
+
+		return httpmock.NewStringResponse(201, ""), nil
+	})
+
+	instructions := []*RefundInstruction{
+		{Row: 1, InstructionUUID: "A0000000000000000000000000000001", OriginalPaymentReference: "done", Amount: "1"},
+		{Row: 2, InstructionUUID: "A0000000000000000000000000000002", OriginalPaymentReference: "ref2", Amount: "1"},
+		{Row: 3, InstructionUUID: "A0000000000000000000000000000003", OriginalPaymentReference: "missing", Amount: "1"},
+		{Row: 4, InstructionUUID: "A0000000000000000000000000000004", Amount: "1"},
+		{Row: 5, InstructionUUID: "a0000000000000000000000000000002", OriginalPaymentReference: "ref2", Amount: "1"},
+	}
+
+	batch := &RefundBatch{Client: client, Concurrency: 2}
+	batch.Complete([]*RefundResult{
+		{InstructionUUID: "a0000000000000000000000000000001", Status: BatchStatusCreated},
+		{InstructionUUID: "A0000000000000000000000000000003", Status: BatchStatusFailed},
+	})
+
+	results := make(map[int]*RefundResult)
+
+	err = batch.Run(context.Background(), instructions, func(result *RefundResult) error {
+		results[result.Row] = result
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, 2, len(sent))
+
+	assert.Equal(t, BatchStatusCreated, results[2].Status)
+	assert.Equal(t, "A0000000000000000000000000000002", results[2].ID)
+
+	assert.Equal(t, BatchStatusFailed, results[3].Status)
+	assert.Equal(t, []string{"RF02"}, results[3].ErrorCodes)
+	assert.Equal(t, "Original Payment not found", results[3].Error)
+
+	assert.Equal(t, BatchStatusInvalid, results[4].Status)
+	assert.Equal(t, ErrNoOriginalPaymentReference.Error(), results[4].Error)
+
+	assert.Equal(t, BatchStatusInvalid, results[5].Status)
+	assert.Equal(t, ErrDuplicateInstructionUUID.Error(), results[5].Error)
+}
+
+func TestRefundBatchResume(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+	assert.Nil(t, err)
+
+	ctx, interrupt := context.WithCancel(context.Background())
+
+	var paths []string
+
+	httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+
+		// The first refund is interrupted after it has been sent.
+		if len(paths) == 1 {
+			interrupt()
+			<-req.Context().Done()
+
+			return nil, req.Context().Err()
+		}
+
+		return httpmock.NewStringResponse(201, ""), nil
+	})
+
+	instructions := []*RefundInstruction{
+		{Row: 1, InstructionUUID: "a0000000000000000000000000000001", OriginalPaymentReference: "ref1", Amount: "1"},
+		{Row: 2, InstructionUUID: "A0000000000000000000000000000002", OriginalPaymentReference: "ref2", Amount: "1"},
+	}
+
+	var results []*RefundResult
+
+	report := func(result *RefundResult) error {
+		results = append(results, result)
+		return nil
+	}
+
+	batch := &RefundBatch{Client: client}
+
+	err = batch.Run(ctx, instructions, report)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(results))
+
+	batch.Complete(results)
+
+	err = batch.Run(context.Background(), instructions, report)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+
+	assert.Equal(t, []string{
+		"PUT /swish-cpcapi/api/v2/refunds/A0000000000000000000000000000001",
+		"PUT /swish-cpcapi/api/v2/refunds/A0000000000000000000000000000001",
+		"PUT /swish-cpcapi/api/v2/refunds/A0000000000000000000000000000002",
+	}, paths)
+}
+
+func TestReadRefundResults(t *testing.T) {
+	results, err := ReadRefundResults(strings.NewReader("{\"row\":1,\"instructionUUID\":\"A1\",\"status\":\"CREATED\"}\n{\"row\":2,\"instr"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "A1", results[0].InstructionUUID)
+}
@@ -0,0 +1,227 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is the error when a request is not sent because the circuit breaker is open.
+	ErrCircuitOpen = errors.New("Error: Circuit breaker is open, Swish API is unavailable")
+)
+
+// CircuitState represents the state of a circuit breaker.
+type CircuitState int
+
+// States of a circuit breaker.
+const (
+	// CircuitClosed is the state when requests are sent to Swish API.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen is the state when requests fail with ErrCircuitOpen without being sent.
+	CircuitOpen
+	// CircuitHalfOpen is the state when a probe request is sent to find out if Swish API is available again.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker represents the configuration of the circuit breaker around requests to Swish API.
+//
+// The circuit opens after a number of consecutive failures, transport errors or responses with
+// a 5xx status code, and requests fail fast with ErrCircuitOpen. After the open timeout one probe
+// request at a time is sent in the half-open state, closing the circuit when it succeeds and
+// opening it again when it fails.
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failures that opens the circuit, 5 when zero.
+	Failures int
+	// OpenTimeout is how long the circuit stays open before a probe request is sent, 30 seconds when zero.
+	OpenTimeout time.Duration
+	// OnStateChange is called when the state of the circuit changes.
+	OnStateChange func(from, to CircuitState)
+}
+
+// breakerResult represents the outcome of a request for the circuit breaker.
+type breakerResult int
+
+const (
+	breakerSuccess breakerResult = iota
+	breakerFailure
+	breakerIgnore
+)
+
+// breaker represents the state of a circuit breaker.
+type breaker struct {
+	config CircuitBreaker
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newBreaker creates a new closed circuit breaker, or nil without a configuration.
+func newBreaker(config *CircuitBreaker) *breaker {
+	if config == nil {
+		return nil
+	}
+
+	c := *config
+
+	if c.Failures <= 0 {
+		c.Failures = 5
+	}
+
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+
+	return &breaker{config: c}
+}
+
+// allow returns ErrCircuitOpen if a request may not be sent and if the request is a probe.
+// A request that is allowed must report its outcome with done.
+func (b *breaker) allow() (bool, error) {
+	b.mu.Lock()
+	from := b.state
+	probe, err := b.allowLocked()
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+
+	return probe, err
+}
+
+// allowLocked returns ErrCircuitOpen if a request may not be sent and if the request is a
+// probe, must be called with the lock held.
+func (b *breaker) allowLocked() (bool, error) {
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return false, ErrCircuitOpen
+		}
+
+		b.state = CircuitHalfOpen
+		fallthrough
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+
+		b.probing = true
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// done reports the outcome of a request that was allowed.
+func (b *breaker) done(probe bool, result breakerResult) {
+	b.mu.Lock()
+	from := b.state
+	b.doneLocked(probe, result)
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// doneLocked reports the outcome of a request, must be called with the lock held.
+func (b *breaker) doneLocked(probe bool, result breakerResult) {
+	if probe {
+		b.probing = false
+
+		switch result {
+		case breakerSuccess:
+			b.failures = 0
+			b.state = CircuitClosed
+		case breakerFailure:
+			b.open()
+		}
+
+		return
+	}
+
+	// Requests sent before the circuit opened do not change an open or half-open circuit.
+	if b.state != CircuitClosed {
+		return
+	}
+
+	switch result {
+	case breakerSuccess:
+		b.failures = 0
+	case breakerFailure:
+		b.failures++
+
+		if b.failures >= b.config.Failures {
+			b.open()
+		}
+	}
+}
+
+// open opens the circuit, must be called with the lock held.
+func (b *breaker) open() {
+	b.openedAt = time.Now()
+	b.state = CircuitOpen
+}
+
+// notify calls the state change hook if the state has changed.
+func (b *breaker) notify(from, to CircuitState) {
+	if from != to && b.config.OnStateChange != nil {
+		b.config.OnStateChange(from, to)
+	}
+}
+
+// breakerOutcome returns the outcome of a request that was sent for the circuit breaker.
+// Requests that failed because the context was cancelled say nothing about Swish API and are
+// ignored, while requests that timed out in flight count as failures since Swish API did not
+// respond in time. Requests with a context that is done before they are sent never get here.
+func breakerOutcome(ctx context.Context, res *http.Response, err error) breakerResult {
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return breakerIgnore
+		}
+
+		return breakerFailure
+	}
+
+	if res.StatusCode >= 500 {
+		return breakerFailure
+	}
+
+	return breakerSuccess
+}
+
+// CircuitState returns the state of the circuit breaker, always CircuitClosed without a circuit breaker.
+func (s *Client) CircuitState() CircuitState {
+	if s.breaker == nil {
+		return CircuitClosed
+	}
+
+	s.breaker.mu.Lock()
+	defer s.breaker.mu.Unlock()
+
+	// An open circuit that has timed out lets the next request through as a probe.
+	if s.breaker.state == CircuitOpen && time.Since(s.breaker.openedAt) >= s.breaker.config.OpenTimeout {
+		return CircuitHalfOpen
+	}
+
+	return s.breaker.state
+}
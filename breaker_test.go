@@ -0,0 +1,191 @@
+package swish
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	var changes []CircuitState
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		CircuitBreaker: &CircuitBreaker{
+			Failures:    2,
+			OpenTimeout: 50 * time.Millisecond,
+			OnStateChange: func(from, to CircuitState) {
+				changes = append(changes, to)
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	calls := 0
+	status := 500
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", func(req *http.Request) (*http.Response, error) {
+		calls++
+		return httpmock.NewStringResponse(status, `{"id":"AB23D7406ECE4542A80152D909EF9F6B"}`), nil
+	})
+
+	get := func() error {
+		_, err := client.PaymentRequest(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+		return err
+	}
+
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	assert.NotNil(t, get())
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+	assert.NotNil(t, get())
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+
+	assert.Equal(t, ErrCircuitOpen, get())
+	assert.Equal(t, 2, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, client.CircuitState())
+
+	// A failed probe opens the circuit again.
+	assert.NotNil(t, get())
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+	assert.Equal(t, ErrCircuitOpen, get())
+
+	time.Sleep(60 * time.Millisecond)
+
+	status = 200
+
+	assert.Nil(t, get())
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+
+	// Client errors do not count as failures.
+	status = 422
+
+	for i := 0; i < 3; i++ {
+		assert.NotNil(t, get())
+	}
+
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+}
+
+func TestBreakerProbe(t *testing.T) {
+	b := newBreaker(&CircuitBreaker{Failures: 1, OpenTimeout: time.Millisecond})
+
+	probe, err := b.allow()
+	assert.Nil(t, err)
+	assert.False(t, probe)
+
+	b.done(probe, breakerFailure)
+	time.Sleep(2 * time.Millisecond)
+
+	probe, err = b.allow()
+	assert.Nil(t, err)
+	assert.True(t, probe)
+
+	// Only one probe at a time.
+	_, err = b.allow()
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// A probe that was interrupted lets the next request probe.
+	b.done(probe, breakerIgnore)
+
+	probe, err = b.allow()
+	assert.Nil(t, err)
+	assert.True(t, probe)
+
+	b.done(probe, breakerSuccess)
+	assert.Equal(t, CircuitClosed, b.state)
+}
+
+func TestCircuitBreakerTimeout(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:            "test",
+		Passphrase:     "swish",
+		P12:            "./certs/test.p12",
+		Root:           "./certs/root.pem",
+		Timeouts:       Timeouts{PaymentRequest: 10 * time.Millisecond},
+		CircuitBreaker: &CircuitBreaker{Failures: 2},
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	get := func(ctx context.Context) error {
+		_, err := client.PaymentRequest(ctx, "AB23D7406ECE4542A80152D909EF9F6B")
+		return err
+	}
+
+	// Cancelled requests do not count as failures.
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(5*time.Millisecond, cancel)
+
+		assert.Equal(t, context.Canceled, get(ctx))
+	}
+
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	// Requests that time out do.
+	assert.Equal(t, context.DeadlineExceeded, get(context.Background()))
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+	assert.Equal(t, context.DeadlineExceeded, get(context.Background()))
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+
+	assert.Equal(t, ErrCircuitOpen, get(context.Background()))
+}
+
+func TestCircuitBreakerExpiredContext(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:            "test",
+		Passphrase:     "swish",
+		P12:            "./certs/test.p12",
+		Root:           "./certs/root.pem",
+		CircuitBreaker: &CircuitBreaker{Failures: 2},
+	})
+	assert.Nil(t, err)
+
+	calls := 0
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", func(req *http.Request) (*http.Response, error) {
+		calls++
+		return httpmock.NewStringResponse(200, `{"id":"AB23D7406ECE4542A80152D909EF9F6B"}`), nil
+	})
+
+	// Contexts that expired before the request was sent do not count as failures.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.PaymentRequest(ctx, "AB23D7406ECE4542A80152D909EF9F6B")
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+}
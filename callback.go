@@ -0,0 +1,348 @@
+package swish
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidCallbackToken is the error when a callback URL's token does not match its route.
+	ErrInvalidCallbackToken = errors.New("Error: Invalid callback token")
+
+	// ErrCallbackRouteMismatch is the error when a callback's body does not belong to the callback URL's route.
+	ErrCallbackRouteMismatch = errors.New("Error: Callback does not match callback route")
+)
+
+// Callback represents a callback from Swish API for a payment request or refund.
+type Callback struct {
+	Type string
+	*PaymentRequest
+
+	// Route is the route from the callback URL when the handler has a callback key.
+	Route *CallbackRoute
+}
+
+// CallbackHandler represents a http handler for Swish callbacks. Callbacks are saved in the
+// store, if any, and passed to the hooks. If a hook returns an error the handler responds
+// with an error so Swish delivers the callback again.
+//
+// When the handler has a callback key the callback URL must be built with BuildCallbackURL
+// using the same key. The route is parsed from the URL and callbacks with an invalid token or
+// a body that does not match the route's reference are rejected.
+//
+// Each status change of a payment request or refund is dispatched once, callbacks that are
+// delivered again are acknowledged without calling the hooks. A memory dedup store is used
+// when the handler has no dedup store, unless DisableDedup is set.
+type CallbackHandler struct {
+	Store       Store
+	Audit       AuditSink
+	CallbackKey []byte
+
+	// Events is used to publish events for status changes. When the store is a SQL store and
+	// Events is a SQL outbox in the same database, the callback and its event are saved in one
+	// transaction before the hooks are called and the callback fails if the transaction does,
+	// so the event is delivered at least once. Other publishers are called after the hooks and
+	// events that can not be published are logged, so they are delivered at most once.
+	Events EventPublisher
+
+	// Dedup is used to claim each status change before it is dispatched, a memory dedup store when nil.
+	Dedup DedupStore
+	// DedupTTL is how long a status change is claimed, 24 hours when zero.
+	DedupTTL time.Duration
+	// DisableDedup dispatches every callback, also callbacks that are delivered again.
+	DisableDedup bool
+
+	dedupOnce sync.Once
+	dedup     DedupStore
+
+	// OnCallback is called for every callback.
+	OnCallback func(context.Context, *Callback) error
+	// OnPaid is called for paid payment requests and refunds.
+	OnPaid func(context.Context, *Callback) error
+	// OnDeclined is called for declined payment requests.
+	OnDeclined func(context.Context, *Callback) error
+	// OnCancelled is called for cancelled payment requests.
+	OnCancelled func(context.Context, *Callback) error
+	// OnError is called for payment requests and refunds that failed.
+	OnError func(context.Context, *Callback) error
+}
+
+// ServeHTTP handles a callback from Swish API.
+func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var route *CallbackRoute
+
+	if h.CallbackKey != nil {
+		var err error
+
+		route, err = ParseCallbackURL(r.URL, h.CallbackKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req *PaymentRequest
+	if err := json.Unmarshal(body, &req); err != nil || req == nil || req.ID == "" {
+		http.Error(w, "Invalid callback from Swish API", http.StatusBadRequest)
+		return
+	}
+
+	if route != nil && route.Reference != "" && route.Reference != req.ID &&
+		route.Reference != req.PayeePaymentReference && route.Reference != req.PayerPaymentReference {
+		http.Error(w, ErrCallbackRouteMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cb := &Callback{
+		Type:           TypePaymentRequest,
+		PaymentRequest: req,
+		Route:          route,
+	}
+
+	if req.OriginalPaymentReference != "" {
+		cb.Type = TypeRefund
+	}
+
+	ctx := r.Context()
+
+	// The correlation ID and tenant from the callback URL are passed on to the hooks.
+	if route != nil {
+		if route.CorrelationID != "" {
+			ctx = WithCorrelationID(ctx, route.CorrelationID)
+		}
+
+		if route.Tenant != "" {
+			ctx = WithTenant(ctx, route.Tenant)
+		}
+	}
+
+	err = h.Dispatch(ctx, cb)
+
+	if h.Audit != nil {
+		record := &AuditRecord{
+			Time:          start,
+			Method:        r.Method,
+			Endpoint:      r.URL.Path,
+			CorrelationID: CorrelationID(ctx),
+			Tenant:        Tenant(ctx),
+			InstructionID: req.ID,
+			Payload:       redactPayload(body),
+			Status:        req.Status,
+			Latency:       time.Since(start),
+		}
+
+		if req.ErrorCode != "" {
+			record.ErrorCodes = []string{req.ErrorCode}
+		}
+
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		if err := h.Audit.Audit(ctx, record); err != nil {
+			logf(ctx, "failed to write audit record: %s", err)
+		}
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Dispatch saves the given callback in the store and calls the hooks. Status changes that
+// already have been dispatched are skipped unless DisableDedup is set.
+func (h *CallbackHandler) Dispatch(ctx context.Context, cb *Callback) error {
+	if h.DisableDedup {
+		return h.dispatch(ctx, cb)
+	}
+
+	dedup := h.dedupStore()
+
+	ttl := h.DedupTTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+
+	key := cb.ID + ":" + cb.Status
+
+	claimed, err := dedup.Claim(ctx, key, ttl)
+	if err != nil || !claimed {
+		return err
+	}
+
+	if err := h.dispatch(ctx, cb); err != nil {
+		// Release the claim so the callback can be processed when it is delivered again.
+		if err := dedup.Release(ctx, key); err != nil {
+			logf(ctx, "failed to release callback %s: %s", key, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// dedupStore returns the handler's dedup store, a memory dedup store that is created on first
+// use when the handler has none.
+func (h *CallbackHandler) dedupStore() DedupStore {
+	if h.Dedup != nil {
+		return h.Dedup
+	}
+
+	h.dedupOnce.Do(func() {
+		h.dedup = NewMemoryDedupStore()
+	})
+
+	return h.dedup
+}
+
+// dispatch saves the given callback in the store and calls the hooks.
+func (h *CallbackHandler) dispatch(ctx context.Context, cb *Callback) error {
+	store, outbox, transactional := sqlOutbox(h.Store, h.Events)
+
+	switch {
+	case transactional:
+		if err := saveAndPublishTx(ctx, store, outbox, contextEvent(ctx, cb.Type, cb.PaymentRequest), cb.Type, cb.PaymentRequest); err != nil {
+			return err
+		}
+	case h.Store != nil:
+		if err := h.Store.Save(ctx, cb.Type, cb.PaymentRequest); err != nil {
+			return err
+		}
+	}
+
+	if h.OnCallback != nil {
+		if err := h.OnCallback(ctx, cb); err != nil {
+			return err
+		}
+	}
+
+	var hook func(context.Context, *Callback) error
+
+	switch cb.Status {
+	case StatusPaid:
+		hook = h.OnPaid
+	case StatusDeclined:
+		hook = h.OnDeclined
+	case StatusCancelled:
+		hook = h.OnCancelled
+	case StatusError:
+		hook = h.OnError
+	}
+
+	if hook != nil {
+		if err := hook(ctx, cb); err != nil {
+			return err
+		}
+	}
+
+	if h.Events != nil && !transactional {
+		if event := contextEvent(ctx, cb.Type, cb.PaymentRequest); event != nil {
+			// The hooks have been called, so the callback is not failed and delivered again
+			// when only the event could not be published.
+			if err := h.Events.Publish(ctx, event); err != nil {
+				logf(ctx, "failed to publish %s event for %s: %s", event.Type, cb.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CallbackRoute represents the routing information in a callback URL built with BuildCallbackURL.
+type CallbackRoute struct {
+	// Type is the type of payment, like TypePaymentRequest or a type defined by the application.
+	Type string
+	// Tenant is the tenant the payment belongs to.
+	Tenant string
+	// Reference is the payment reference or instruction ID the payment belongs to.
+	Reference string
+	// CorrelationID is the correlation ID of the request that created the payment.
+	CorrelationID string
+}
+
+// BuildCallbackURL builds a callback URL from the given base URL and route. The route is added
+// as query parameters together with a HMAC token created with the given key, so the route
+// can be trusted when it is parsed back with ParseCallbackURL.
+func BuildCallbackURL(base string, key []byte, route *CallbackRoute) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for name, value := range route.values() {
+		query[name] = value
+	}
+
+	query.Set("token", callbackToken(key, route))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// ParseCallbackURL parses the route from a callback URL built with BuildCallbackURL and
+// returns ErrInvalidCallbackToken if the token does not match the route.
+func ParseCallbackURL(u *url.URL, key []byte) (*CallbackRoute, error) {
+	query := u.Query()
+
+	route := &CallbackRoute{
+		Type:          query.Get("type"),
+		Tenant:        query.Get("tenant"),
+		Reference:     query.Get("ref"),
+		CorrelationID: query.Get("cid"),
+	}
+
+	token := query.Get("token")
+	if token == "" || !hmac.Equal([]byte(token), []byte(callbackToken(key, route))) {
+		return nil, ErrInvalidCallbackToken
+	}
+
+	return route, nil
+}
+
+// values returns the route's query parameters.
+func (r *CallbackRoute) values() url.Values {
+	values := url.Values{}
+
+	for name, value := range map[string]string{
+		"type":   r.Type,
+		"tenant": r.Tenant,
+		"ref":    r.Reference,
+		"cid":    r.CorrelationID,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+
+	return values
+}
+
+// callbackToken returns the HMAC token for the given route.
+func callbackToken(key []byte, route *CallbackRoute) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(route.values().Encode()))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
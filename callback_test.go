@@ -0,0 +1,161 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+)
+
+func TestCallbackHandler(t *testing.T) {
+	store := NewMemoryStore()
+
+	var paid, declined []*Callback
+
+	handler := &CallbackHandler{
+		Store: store,
+		OnPaid: func(ctx context.Context, cb *Callback) error {
+			paid = append(paid, cb)
+			return nil
+		},
+		OnDeclined: func(ctx context.Context, cb *Callback) error {
+			declined = append(declined, cb)
+			return errors.New("failed")
+		},
+	}
+
+	tests := []struct {
+		description  string
+		body         string
+		expectedCode int
+	}{
+		{
+			description:  "paid payment request",
+			body:         `{"id":"AB23D7406ECE4542A80152D909EF9F6B","paymentReference":"6D6CD7406ECE4542A80152D909EF9F6B","amount":"100","status":"PAID"}`,
+			expectedCode: 200,
+		},
+		{
+			description:  "paid refund",
+			body:         `{"id":"1E2FD7406ECE4542A80152D909EF9F6B","originalPaymentReference":"6D6CD7406ECE4542A80152D909EF9F6B","amount":"10","status":"PAID"}`,
+			expectedCode: 200,
+		},
+		{
+			description:  "hook error",
+			body:         `{"id":"2E2FD7406ECE4542A80152D909EF9F6B","status":"DECLINED"}`,
+			expectedCode: 500,
+		},
+		{
+			description:  "invalid body",
+			body:         `[]`,
+			expectedCode: 400,
+		},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/callback", strings.NewReader(test.body)))
+
+		assert.Equal(t, test.expectedCode, rec.Code, test.description)
+	}
+
+	assert.Equal(t, 2, len(paid))
+	assert.Equal(t, TypePaymentRequest, paid[0].Type)
+	assert.Equal(t, TypeRefund, paid[1].Type)
+	assert.Equal(t, 1, len(declined))
+
+	amount, err := RefundableAmount(context.Background(), store, "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+	assert.Equal(t, "90.00", amount)
+}
+
+func TestCallbackURL(t *testing.T) {
+	key := []byte("secret")
+
+	callbackURL, err := BuildCallbackURL("https://example.com/api/swishcb?a=b", key, &CallbackRoute{
+		Type:      "order",
+		Tenant:    "shop",
+		Reference: "0123456789",
+	})
+	assert.Nil(t, err)
+
+	u, err := url.Parse(callbackURL)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", u.Query().Get("a"))
+
+	route, err := ParseCallbackURL(u, key)
+	assert.Nil(t, err)
+	assert.Equal(t, &CallbackRoute{Type: "order", Tenant: "shop", Reference: "0123456789"}, route)
+
+	_, err = ParseCallbackURL(u, []byte("other"))
+	assert.Equal(t, ErrInvalidCallbackToken, err)
+
+	query := u.Query()
+	query.Set("ref", "9876543210")
+	u.RawQuery = query.Encode()
+
+	_, err = ParseCallbackURL(u, key)
+	assert.Equal(t, ErrInvalidCallbackToken, err)
+}
+
+func TestCallbackHandlerRoute(t *testing.T) {
+	key := []byte("secret")
+
+	var callbacks []*Callback
+
+	handler := &CallbackHandler{
+		CallbackKey: key,
+		OnCallback: func(ctx context.Context, cb *Callback) error {
+			callbacks = append(callbacks, cb)
+			return nil
+		},
+	}
+
+	callbackURL, err := BuildCallbackURL("https://example.com/callback", key, &CallbackRoute{
+		Type:      TypePaymentRequest,
+		Tenant:    "shop",
+		Reference: "0123456789",
+	})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		description  string
+		url          string
+		body         string
+		expectedCode int
+	}{
+		{
+			description:  "valid route",
+			url:          callbackURL,
+			body:         `{"id":"AB23D7406ECE4542A80152D909EF9F6B","payeePaymentReference":"0123456789","status":"PAID"}`,
+			expectedCode: 200,
+		},
+		{
+			description:  "body for another payment",
+			url:          callbackURL,
+			body:         `{"id":"AB23D7406ECE4542A80152D909EF9F6B","payeePaymentReference":"9876543210","status":"PAID"}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "missing token",
+			url:          "https://example.com/callback",
+			body:         `{"id":"AB23D7406ECE4542A80152D909EF9F6B","payeePaymentReference":"0123456789","status":"PAID"}`,
+			expectedCode: 403,
+		},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", test.url, strings.NewReader(test.body)))
+
+		assert.Equal(t, test.expectedCode, rec.Code, test.description)
+	}
+
+	assert.Equal(t, 1, len(callbacks))
+	assert.Equal(t, "shop", callbacks[0].Route.Tenant)
+}
@@ -0,0 +1,317 @@
+package swish
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoCertificate is the error when a certificate source has no certificate.
+	ErrNoCertificate = errors.New("Error: No client certificate")
+)
+
+// CertificateSource represents a source of client certificates that can change at runtime.
+type CertificateSource interface {
+	Certificate() (*tls.Certificate, error)
+}
+
+// CertificateFunc is a function that implements CertificateSource.
+type CertificateFunc func() (*tls.Certificate, error)
+
+// Certificate returns the certificate from the function.
+func (f CertificateFunc) Certificate() (*tls.Certificate, error) {
+	return f()
+}
+
+// CertificateEvent represents a certificate rotation or a failed certificate load.
+type CertificateEvent struct {
+	// Certificate is the certificate that is used after the event.
+	Certificate *tls.Certificate
+	// Err is the error from the certificate source when loading failed.
+	Err error
+}
+
+// MemoryCertificate represents a certificate source that holds a certificate in memory.
+type MemoryCertificate struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewMemoryCertificate creates a new memory certificate source with the given certificate.
+func NewMemoryCertificate(cert *tls.Certificate) *MemoryCertificate {
+	return &MemoryCertificate{cert: cert}
+}
+
+// Set replaces the certificate.
+func (m *MemoryCertificate) Set(cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cert = cert
+}
+
+// Certificate returns the current certificate.
+func (m *MemoryCertificate) Certificate() (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil {
+		return nil, ErrNoCertificate
+	}
+
+	return m.cert, nil
+}
+
+// FileCertificate represents a certificate source that loads a P12 file and
+// reloads it when the file's modification time changes.
+type FileCertificate struct {
+	Path       string
+	Passphrase string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+// NewFileCertificate creates a new file certificate source for the given P12 file.
+func NewFileCertificate(path, passphrase string) *FileCertificate {
+	return &FileCertificate{
+		Path:       path,
+		Passphrase: passphrase,
+	}
+}
+
+// Certificate returns the certificate from the file, reloading it if the file has changed.
+func (f *FileCertificate) Certificate() (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.cert != nil && info.ModTime().Equal(f.modTime) {
+		return f.cert, nil
+	}
+
+	p12, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := loadP12(p12, f.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	f.cert = &cert
+	f.modTime = info.ModTime()
+
+	return f.cert, nil
+}
+
+// rotatingCertificate represents the client certificate from a certificate source, used by
+// tls.Config.GetClientCertificate. If the source fails the last loaded certificate is used so
+// a broken rotation does not take down the client.
+type rotatingCertificate struct {
+	source CertificateSource
+	fn     func(CertificateEvent)
+
+	mu      sync.Mutex
+	current *tls.Certificate
+}
+
+// newRotatingCertificate creates a rotating certificate with the source's current certificate.
+func newRotatingCertificate(source CertificateSource, fn func(CertificateEvent)) (*rotatingCertificate, error) {
+	current, err := source.Certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rotatingCertificate{
+		source:  source,
+		fn:      fn,
+		current: current,
+	}, nil
+}
+
+// GetClientCertificate asks the source for a certificate and returns it, or the last loaded
+// certificate if the source fails. The event function is called when the certificate is
+// rotated or fails to load.
+func (r *rotatingCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := r.source.Certificate()
+
+	r.mu.Lock()
+
+	var event *CertificateEvent
+
+	switch {
+	case err != nil:
+		event = &CertificateEvent{Certificate: r.current, Err: err}
+	case !sameCertificate(cert, r.current):
+		r.current = cert
+		event = &CertificateEvent{Certificate: cert}
+	}
+
+	current := r.current
+	r.mu.Unlock()
+
+	// The event function is called without the lock, so it can inspect the client's certificate.
+	if event != nil && r.fn != nil {
+		r.fn(*event)
+	}
+
+	return current, nil
+}
+
+// Current returns the last loaded certificate without asking the source.
+func (r *rotatingCertificate) Current() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+// sameCertificate returns true if the given certificates have the same leaf certificate.
+func sameCertificate(a, b *tls.Certificate) bool {
+	if a == b {
+		return true
+	}
+
+	if a == nil || b == nil || len(a.Certificate) == 0 || len(b.Certificate) == 0 {
+		return false
+	}
+
+	return bytes.Equal(a.Certificate[0], b.Certificate[0])
+}
+
+// CertificateDetails represents the details of a certificate.
+type CertificateDetails struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// CertificateInfo represents the details of the loaded client certificate and root certificates.
+type CertificateInfo struct {
+	CertificateDetails
+
+	// SwishNumber is the Swish number from the certificate's common name.
+	SwishNumber string `json:"swishNumber"`
+	// OrganizationNumber is the organization number from the certificate's organization.
+	OrganizationNumber string               `json:"organizationNumber"`
+	Roots              []CertificateDetails `json:"roots"`
+}
+
+// ExpiresWithin returns true if the client certificate expires within the given duration.
+func (i *CertificateInfo) ExpiresWithin(d time.Duration) bool {
+	return time.Now().Add(d).After(i.NotAfter)
+}
+
+// CertificateInfo returns the details of the client certificate and root certificates that are used.
+// The roots are the ones loaded when the client was created, and the client certificate is the
+// last one loaded, so inspecting does not read files, ask the secret provider or rotate the certificate.
+func (c *Client) CertificateInfo() (*CertificateInfo, error) {
+	cert, err := c.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return nil, ErrNoCertificate
+		}
+
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := &CertificateInfo{
+		CertificateDetails: certificateDetails(leaf),
+		SwishNumber:        leaf.Subject.CommonName,
+	}
+
+	if len(leaf.Subject.Organization) > 0 {
+		info.OrganizationNumber = leaf.Subject.Organization[0]
+	}
+
+	for _, root := range c.roots {
+		info.Roots = append(info.Roots, certificateDetails(root))
+	}
+
+	return info, nil
+}
+
+// WatchCertificateExpiry checks the client certificate on the given interval until the
+// context is done and calls fn when it expires within the given duration or cannot be
+// inspected. If fn is nil a warning is logged instead. The interval is a day when zero or
+// negative. It is meant to run in a goroutine.
+func (c *Client) WatchCertificateExpiry(ctx context.Context, interval, within time.Duration, fn func(*CertificateInfo, error)) {
+	if fn == nil {
+		fn = func(info *CertificateInfo, err error) {
+			if err != nil {
+				log.Printf("swish: failed to inspect client certificate: %s", err)
+				return
+			}
+
+			log.Printf("swish: client certificate for %s expires %s", info.SwishNumber, info.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		info, err := c.CertificateInfo()
+		if err != nil || info.ExpiresWithin(within) {
+			fn(info, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// certificate returns the client certificate that is currently used.
+func (c *Client) certificate() (*tls.Certificate, error) {
+	if c.rotating != nil {
+		return c.rotating.Current(), nil
+	}
+
+	if len(c.tlsConfig.Certificates) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	return &c.tlsConfig.Certificates[0], nil
+}
+
+// certificateDetails returns the details of the given certificate.
+func certificateDetails(cert *x509.Certificate) CertificateDetails {
+	return CertificateDetails{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+}
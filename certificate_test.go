@@ -0,0 +1,227 @@
+package swish
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+)
+
+func TestFileCertificate(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "swish.p12")
+	assert.Nil(t, os.WriteFile(path, p12, 0600))
+
+	source := NewFileCertificate(path, "swish")
+
+	first, err := source.Certificate()
+	assert.Nil(t, err)
+
+	second, err := source.Certificate()
+	assert.Nil(t, err)
+	assert.True(t, first == second)
+
+	// Touch the file so it is reloaded.
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(path, later, later))
+
+	third, err := source.Certificate()
+	assert.Nil(t, err)
+	assert.True(t, first != third)
+	assert.True(t, sameCertificate(first, third))
+}
+
+func TestCertificateRotation(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	cert, err := loadP12(p12, "swish")
+	assert.Nil(t, err)
+
+	source := NewMemoryCertificate(&cert)
+
+	var events []CertificateEvent
+
+	config, err := createTLSConfig(&Options{
+		Env:                "test",
+		CertificateSource:  source,
+		Root:               "./certs/root.pem",
+		OnCertificateEvent: func(e CertificateEvent) { events = append(events, e) },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(config.Certificates))
+
+	res, err := config.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.True(t, res == &cert)
+	assert.Equal(t, 0, len(events))
+
+	rotated := tls.Certificate{Certificate: [][]byte{[]byte("rotated")}}
+	source.Set(&rotated)
+
+	res, err = config.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.True(t, res == &rotated)
+	assert.Equal(t, 1, len(events))
+	assert.Nil(t, events[0].Err)
+
+	// A failing source keeps the last certificate.
+	source.Set(nil)
+
+	res, err = config.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.True(t, res == &rotated)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, ErrNoCertificate, events[1].Err)
+
+	_, err = createTLSConfig(&Options{
+		Env: "test",
+		CertificateSource: CertificateFunc(func() (*tls.Certificate, error) {
+			return nil, errors.New("failed")
+		}),
+		Root: "./certs/root.pem",
+	})
+	assert.Equal(t, errors.New("failed"), err)
+}
+
+func TestCertificateInfo(t *testing.T) {
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+	assert.Nil(t, err)
+
+	info, err := client.CertificateInfo()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "1231181189", info.SwishNumber)
+	assert.Equal(t, "5569137382", info.OrganizationNumber)
+	assert.Equal(t, "1b46f254ae99f31c", info.SerialNumber)
+	assert.Equal(t, "CN=1231181189,O=5569137382,C=SE", info.Subject)
+	assert.Equal(t, time.Date(2017, 10, 26, 21, 59, 59, 0, time.UTC), info.NotAfter.UTC())
+	assert.True(t, info.ExpiresWithin(0))
+
+	assert.Equal(t, 1, len(info.Roots))
+	assert.Equal(t, "CN=Test Swish Root CA v1 Test,OU=Swish Member Banks CA,O=Getswish AB", info.Roots[0].Subject)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var expired *CertificateInfo
+	client.WatchCertificateExpiry(ctx, time.Hour, 30*24*time.Hour, func(info *CertificateInfo, err error) {
+		expired = info
+		cancel()
+	})
+
+	assert.NotNil(t, expired)
+}
+
+// countingSecretProvider is a secret provider that counts the secrets it is asked for.
+type countingSecretProvider struct {
+	SecretProvider
+	calls int
+}
+
+// Secret counts the call and returns the secret from the wrapped provider.
+func (p *countingSecretProvider) Secret(name string) ([]byte, error) {
+	p.calls++
+	return p.SecretProvider.Secret(name)
+}
+
+func TestCertificateInfoUsesLoadedCertificates(t *testing.T) {
+	dir := t.TempDir()
+
+	root, err := os.ReadFile("./certs/root.pem")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, SecretRoot), root, 0600))
+
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	cert, err := loadP12(p12, "swish")
+	assert.Nil(t, err)
+
+	var events []CertificateEvent
+
+	provider := &countingSecretProvider{SecretProvider: &FileSecretProvider{Dir: dir}}
+
+	client, err := NewClient(&Options{
+		Env:                "test",
+		CertificateSource:  NewMemoryCertificate(&cert),
+		Secrets:            provider,
+		OnCertificateEvent: func(e CertificateEvent) { events = append(events, e) },
+	})
+	assert.Nil(t, err)
+
+	calls := provider.calls
+
+	// Replacing the root after the client is created does not change the reported roots.
+	assert.Nil(t, os.Remove(filepath.Join(dir, SecretRoot)))
+
+	info, err := client.CertificateInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, "1231181189", info.SwishNumber)
+	assert.Equal(t, 1, len(info.Roots))
+
+	assert.Equal(t, calls, provider.calls)
+	assert.Equal(t, 0, len(events))
+
+	// A zero interval uses the default instead of panicking.
+	ctx, cancel := context.WithCancel(context.Background())
+	client.WatchCertificateExpiry(ctx, 0, 30*24*time.Hour, func(info *CertificateInfo, err error) {
+		cancel()
+	})
+}
+
+func TestCertificateEventCallsCertificateInfo(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	cert, err := loadP12(p12, "swish")
+	assert.Nil(t, err)
+
+	source := NewMemoryCertificate(&cert)
+
+	var client *Client
+	var infos []*CertificateInfo
+
+	client, err = NewClient(&Options{
+		Env:               "test",
+		CertificateSource: source,
+		Root:              "./certs/root.pem",
+		OnCertificateEvent: func(e CertificateEvent) {
+			info, err := client.CertificateInfo()
+			if err == nil {
+				infos = append(infos, info)
+			}
+		},
+	})
+	assert.Nil(t, err)
+
+	// A failing source sends an event with the last loaded certificate.
+	source.Set(nil)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		client.tlsConfig.GetClientCertificate(nil)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("certificate event hook calling CertificateInfo deadlocked")
+	}
+
+	assert.Equal(t, 1, len(infos))
+	assert.Equal(t, "1231181189", infos[0].SwishNumber)
+}
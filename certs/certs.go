@@ -0,0 +1,218 @@
+// Package certs contains helpers for enrolling Swish client certificates.
+//
+// A new certificate is enrolled by generating a key and a certificate signing request,
+// uploading the request to the Swish certificate portal and importing the returned
+// certificate, which can then be encoded as a P12 or PEM bundle for the Swish client.
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	// ErrNoCertificate is the error when PEM data contains no certificates.
+	ErrNoCertificate = errors.New("Error: No certificate in PEM data")
+
+	// ErrNoPrivateKey is the error when PEM data contains no private key.
+	ErrNoPrivateKey = errors.New("Error: No private key in PEM data")
+
+	// ErrKeyMismatch is the error when a certificate does not match the private key.
+	ErrKeyMismatch = errors.New("Error: Certificate does not match private key")
+)
+
+// KeyType represents the type of private key to generate.
+type KeyType int
+
+const (
+	// RSA4096 is a 4096 bit RSA key.
+	RSA4096 KeyType = iota
+	// ECDSAP256 is an ECDSA key on the P-256 curve.
+	ECDSAP256
+)
+
+// Subject represents the subject of a Swish certificate signing request.
+type Subject struct {
+	// SwishNumber is the Swish number, used as common name.
+	SwishNumber string
+	// OrganizationNumber is the organization number, used as organization.
+	OrganizationNumber string
+	// Country is the country code, SE when empty.
+	Country string
+}
+
+// GenerateKey generates a new private key of the given type.
+func GenerateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("Unknown key type: %d", keyType)
+	}
+}
+
+// CreateCSR creates a PEM encoded certificate signing request for the given key and subject.
+func CreateCSR(key crypto.Signer, subject Subject) ([]byte, error) {
+	country := subject.Country
+	if country == "" {
+		country = "SE"
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   subject.SwishNumber,
+			Organization: []string{subject.OrganizationNumber},
+			Country:      []string{country},
+		},
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// ParseCertificates parses the PEM encoded certificate chain returned by the Swish certificate portal.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	return certs, nil
+}
+
+// Verify returns an error if the given certificate does not match the given private key.
+func Verify(cert *x509.Certificate, key crypto.Signer) error {
+	pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(key.Public()) {
+		return ErrKeyMismatch
+	}
+
+	return nil
+}
+
+// EncodeKey encodes the given private key as PEM encoded PKCS#8, encrypted with the
+// given passphrase unless it is empty.
+func EncodeKey(key crypto.Signer, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	der, err := pkcs8.MarshalPrivateKey(key, []byte(passphrase), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKey parses a PEM encoded PKCS#8 private key created by EncodeKey.
+func ParseKey(data []byte, passphrase string) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoPrivateKey
+	}
+
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		key, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(passphrase))
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, ErrNoPrivateKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrNoPrivateKey
+	}
+
+	return signer, nil
+}
+
+// EncodePEM verifies that the first certificate matches the private key and returns the
+// PEM encoded certificate chain and private key, which can be used as Cert and Key in the
+// Swish client options.
+func EncodePEM(key crypto.Signer, certs []*x509.Certificate, passphrase string) ([]byte, []byte, error) {
+	if len(certs) == 0 {
+		return nil, nil, ErrNoCertificate
+	}
+
+	if err := Verify(certs[0], key); err != nil {
+		return nil, nil, err
+	}
+
+	var certPEM []byte
+	for _, cert := range certs {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	keyPEM, err := EncodeKey(key, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// EncodeP12 verifies that the first certificate matches the private key and returns a
+// modern encrypted P12 bundle, which can be used as P12 in the Swish client options.
+func EncodeP12(key crypto.Signer, certs []*x509.Certificate, passphrase string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	if err := Verify(certs[0], key); err != nil {
+		return nil, err
+	}
+
+	return pkcs12.Modern.Encode(key, certs[0], certs[1:], passphrase)
+}
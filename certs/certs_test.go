@@ -0,0 +1,82 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+	"github.com/frozzare/go-swish"
+)
+
+func TestEnrollment(t *testing.T) {
+	key, err := GenerateKey(ECDSAP256)
+	assert.Nil(t, err)
+
+	csrPEM, err := CreateCSR(key, Subject{
+		SwishNumber:        "1231181189",
+		OrganizationNumber: "5569137382",
+	})
+	assert.Nil(t, err)
+
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.Nil(t, err)
+	assert.Nil(t, csr.CheckSignature())
+	assert.Equal(t, "CN=1231181189,O=5569137382,C=SE", csr.Subject.String())
+
+	// Sign the request like the Swish certificate portal would.
+	caKey, err := GenerateKey(ECDSAP256)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, caKey)
+	assert.Nil(t, err)
+
+	certs, err := ParseCertificates(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(certs))
+
+	assert.Nil(t, Verify(certs[0], key))
+	assert.Equal(t, ErrKeyMismatch, Verify(certs[0], caKey))
+
+	_, err = EncodeP12(caKey, certs, "secret")
+	assert.Equal(t, ErrKeyMismatch, err)
+
+	p12, err := EncodeP12(key, certs, "secret")
+	assert.Nil(t, err)
+
+	_, err = swish.NewClient(&swish.Options{
+		P12Data:    p12,
+		Passphrase: "secret",
+		Root:       "./root.pem",
+	})
+	assert.Nil(t, err)
+
+	certPEM, keyPEM, err := EncodePEM(key, certs, "secret")
+	assert.Nil(t, err)
+
+	_, err = swish.NewClient(&swish.Options{
+		CertData:   certPEM,
+		KeyData:    keyPEM,
+		Passphrase: "secret",
+		Root:       "./root.pem",
+	})
+	assert.Nil(t, err)
+
+	parsed, err := ParseKey(keyPEM, "secret")
+	assert.Nil(t, err)
+	assert.Nil(t, Verify(certs[0], parsed))
+
+	_, err = ParseCertificates([]byte("invalid"))
+	assert.Equal(t, ErrNoCertificate, err)
+}
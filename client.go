@@ -3,8 +3,11 @@ package swish
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -12,11 +15,34 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"text/template"
+	"time"
 
-	"golang.org/x/crypto/pkcs12"
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	// ErrNoRootCertificates is the error when the configured root contains no certificates.
+	ErrNoRootCertificates = errors.New("Error: No certificates in Swish root")
+
+	// ErrNoProductionRoot is the error when no Swish root is configured for the production
+	// environment, where no root is bundled.
+	ErrNoProductionRoot = errors.New("Error: No Swish root configured, Root or RootData is required in production")
+
+	// ErrPublicKeyNotPinned is the error when no certificate from the Swish server matches a pinned public key.
+	ErrPublicKeyNotPinned = errors.New("Error: Swish server certificate does not match pinned public keys")
+
+	// testRoot is the Swish test root certificate, used when no root is configured in the test environment.
+	//go:embed certs/root.pem
+	testRoot []byte
 )
 
 // Options represents Swish client options.
+//
+// The client certificate is loaded from the first of CertificateSource, Certificate,
+// Cert/CertData with Key/KeyData or P12/P12Data that is configured. Passphrase is used
+// both for P12 files and encrypted PKCS#8 keys.
 type Options struct {
 	Env        string
 	P12        string
@@ -25,11 +51,79 @@ type Options struct {
 	Root       string
 	RootData   []byte
 	Client     *http.Client
+
+	// Cert and CertData is the PEM encoded client certificate chain, and Key and
+	// KeyData is the PEM encoded private key, used instead of a P12.
+	Cert     string
+	CertData []byte
+	Key      string
+	KeyData  []byte
+
+	// Certificate is a pre-built client certificate used instead of a P12.
+	Certificate *tls.Certificate
+
+	// Merchant is the merchant profile with defaults for payment requests and refunds.
+	Merchant *Merchant
+
+	// Store is used to record payment requests and refunds when they are created or fetched.
+	Store Store
+
+	// Events is used to publish events when payment requests and refunds are created or cancelled.
+	Events EventPublisher
+
+	// Audit is used to record every request to the Swish API.
+	Audit AuditSink
+
+	// Secrets is used to read the P12, certificate, key, passphrase and root that
+	// are not configured in the options.
+	Secrets SecretProvider
+
+	// PinnedPublicKeys is a list of base64 encoded SHA-256 hashes of subject public key
+	// infos. When set, a connection is only accepted if a certificate in the server's
+	// chain has one of the public keys.
+	PinnedPublicKeys []string
+
+	// CertificateSource is used instead of P12/P12Data when set and is asked
+	// for the client certificate on every TLS handshake, so certificates can
+	// be rotated without creating a new client.
+	CertificateSource CertificateSource
+
+	// OnCertificateEvent is called when the certificate from the certificate
+	// source has been rotated or failed to load.
+	OnCertificateEvent func(CertificateEvent)
+
+	// Limits are the rate limits and caps on concurrent requests by endpoint, like
+	// /paymentrequests or /refunds. The limit for the empty endpoint is shared by
+	// the endpoints without a limit of their own.
+	Limits map[string]*Limit
+
+	// OnLimitWait is called with the endpoint and the time a request waited for its limit.
+	OnLimitWait func(endpoint string, wait time.Duration)
+
+	// APIVersion is the version of the Swish API used to create payment requests and refunds,
+	// APIVersion1 when empty. Payment requests and refunds are fetched and cancelled with
+	// APIVersion1 since there is no other version of those operations.
+	APIVersion string
+
+	// Timeouts are the timeouts of operations, layered onto the caller's context.
+	Timeouts Timeouts
+
+	// CircuitBreaker enables a circuit breaker that fails requests fast with ErrCircuitOpen
+	// when Swish API is unavailable.
+	CircuitBreaker *CircuitBreaker
 }
 
 // Client represents a Swish client.
 type Client struct {
 	*Options
+
+	tlsConfig       *tls.Config
+	rotating        *rotatingCertificate
+	roots           []*x509.Certificate
+	messageTemplate *template.Template
+	limiters        map[string]*limiter
+	breaker         *breaker
+	refunds         keyedMutex
 }
 
 // Error represents a error object from Swish API.
@@ -39,89 +133,360 @@ type Error struct {
 	ErrorMessage          string `json:"errorMessage,omitempty"`
 }
 
+// errorCodesKey is the context key for collecting the error codes from Swish API.
+type errorCodesKey struct{}
+
+// withErrorCodes returns a context that collects the error codes of a failed request in codes.
+func withErrorCodes(ctx context.Context, codes *[]string) context.Context {
+	return context.WithValue(ctx, errorCodesKey{}, codes)
+}
+
 // NewClient creats a new Swish client.
+//
+// The given options and http client are never modified. Each Swish client gets its own
+// http client and transport, cloned from the configured one, so clients with different
+// certificates can live side by side without touching http.DefaultTransport.
 func NewClient(opts *Options) (*Client, error) {
-	if opts.Client == nil {
-		opts.Client = http.DefaultClient
+	cfg, state, err := loadTLSConfig(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	cfg, err := createTLSConfig(opts)
+	messageTemplate, err := parseMessageTemplate(opts.Merchant)
 	if err != nil {
 		return nil, err
 	}
 
-	if opts.Client.Transport == nil {
-		opts.Client.Transport = http.DefaultTransport
+	o := *opts
+	o.Client = createHTTPClient(opts.Client, cfg)
+
+	return &Client{
+		Options:         &o,
+		tlsConfig:       cfg,
+		rotating:        state.rotating,
+		roots:           state.roots,
+		messageTemplate: messageTemplate,
+		limiters:        newLimiters(opts.Limits),
+		breaker:         newBreaker(opts.CircuitBreaker),
+	}, nil
+}
+
+// createHTTPClient creates a copy of the given http client with a transport
+// that is configured with the given TLS config and the default timeouts that
+// are not configured.
+func createHTTPClient(base *http.Client, cfg *tls.Config) *http.Client {
+	var client http.Client
+	if base != nil {
+		client = *base
 	}
 
-	if _, ok := opts.Client.Transport.(*http.Transport); ok {
-		opts.Client.Transport.(*http.Transport).TLSClientConfig = cfg
+	defaultTransport := client.Transport == nil
+	if defaultTransport {
+		client.Transport = http.DefaultTransport
 	}
 
-	return &Client{opts}, nil
+	// Only a *http.Transport can be configured with the TLS config and timeouts,
+	// other round trippers are used as they are.
+	t, ok := client.Transport.(*http.Transport)
+	if ok {
+		t = t.Clone()
+		t.TLSClientConfig = cfg
+
+		// Replace the dialer of http.DefaultTransport with one with the default dial timeout.
+		if defaultTransport {
+			t.DialContext = nil
+		}
+
+		client.Transport = t
+	}
+
+	setDefaultTimeouts(&client, t)
+
+	return &client
 }
 
 // URL returns the BankID url.
 func (s *Client) URL() string {
+	return s.versionURL(APIVersion1)
+}
+
+// versionURL returns the url for the given version of the Swish API.
+func (s *Client) versionURL(version string) string {
 	switch s.Env {
 	case "production":
-		return "https://cpc.getswish.net/swish-cpcapi/api/v1"
+		return "https://cpc.getswish.net/swish-cpcapi/api/" + version
 	default:
-		return "https://mss.cpc.getswish.net/swish-cpcapi/api/v1"
+		return "https://mss.cpc.getswish.net/swish-cpcapi/api/" + version
 	}
 }
 
 // createTLSConfig creates a TLSConfig with the certificates that are configured.
 func createTLSConfig(opts *Options) (*tls.Config, error) {
-	// Get P12 directly from options or load from file
-	p12 := opts.P12Data
-	if p12 == nil {
-		var err error
-		p12, err = os.ReadFile(opts.P12)
+	tlsConfig, _, err := loadTLSConfig(opts)
+
+	return tlsConfig, err
+}
+
+// tlsState represents the certificates loaded for a TLS config, kept so they can be
+// inspected without loading them again.
+type tlsState struct {
+	rotating *rotatingCertificate
+	roots    []*x509.Certificate
+}
+
+// loadTLSConfig creates a TLSConfig with the certificates that are configured and returns
+// the loaded certificates.
+func loadTLSConfig(opts *Options) (*tls.Config, *tlsState, error) {
+	opts, err := resolveSecrets(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{}
+	state := &tlsState{}
+
+	if opts.CertificateSource != nil {
+		rotating, err := newRotatingCertificate(opts.CertificateSource, opts.OnCertificateEvent)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+
+		state.rotating = rotating
+		tlsConfig.GetClientCertificate = rotating.GetClientCertificate
+	} else {
+		cert, err := loadCertificate(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
-	blocks, err := pkcs12.ToPEM(p12, opts.Passphrase)
+	roots, err := loadRootCertificates(opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	state.roots = roots
+
+	caCertPool := x509.NewCertPool()
+	for _, root := range roots {
+		caCertPool.AddCert(root)
+	}
+
+	tlsConfig.RootCAs = caCertPool
+
+	if len(opts.PinnedPublicKeys) > 0 {
+		tlsConfig.VerifyConnection = createVerifyConnection(opts.PinnedPublicKeys)
+	}
+
+	return tlsConfig, state, nil
+}
+
+// createVerifyConnection creates a function for tls.Config.VerifyConnection that
+// verifies that the server's chain contains one of the given public keys.
+func createVerifyConnection(pins []string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		for _, cert := range state.PeerCertificates {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			pin := base64.StdEncoding.EncodeToString(hash[:])
+
+			for _, p := range pins {
+				if p == pin {
+					return nil
+				}
+			}
+		}
+
+		return ErrPublicKeyNotPinned
 	}
+}
 
-	var pemData []byte
-	for _, b := range blocks {
-		pemData = append(pemData, pem.EncodeToMemory(b)...)
+// loadCertificate loads the client certificate that is configured.
+func loadCertificate(opts *Options) (tls.Certificate, error) {
+	if opts.Certificate != nil {
+		return *opts.Certificate, nil
 	}
 
-	cert, err := tls.X509KeyPair(pemData, pemData)
+	if opts.Cert != "" || opts.CertData != nil {
+		certPEM, err := readData(opts.CertData, opts.Cert)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		keyPEM, err := readData(opts.KeyData, opts.Key)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		return loadKeyPair(certPEM, keyPEM, opts.Passphrase)
+	}
+
+	// Get P12 directly from options or load from file
+	p12, err := readData(opts.P12Data, opts.P12)
 	if err != nil {
-		return nil, err
+		return tls.Certificate{}, err
+	}
+
+	return loadP12(p12, opts.Passphrase)
+}
+
+// readData returns the given data or the content of the given file if data is nil.
+func readData(data []byte, file string) ([]byte, error) {
+	if data != nil {
+		return data, nil
+	}
+
+	return os.ReadFile(file)
+}
+
+// loadRootCertificates loads the root certificates that are configured. If no root is
+// configured the bundled Swish test root is used for the test environment. The production
+// root is not bundled since an authentic copy could not be verified for this repository, so
+// production requires a configured root and fails with ErrNoProductionRoot without one.
+func loadRootCertificates(opts *Options) ([]*x509.Certificate, error) {
+	if opts.RootData == nil && opts.Root == "" {
+		if opts.Env == "production" {
+			return nil, ErrNoProductionRoot
+		}
+
+		return parseRootCertificates(testRoot)
 	}
 
 	// Get CA cert directly from options or load from file
-	caCert := opts.RootData
-	if caCert == nil {
-		var err error
-		caCert, err = os.ReadFile(opts.Root)
+	caCert, err := readData(opts.RootData, opts.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRootCertificates(caCert)
+}
+
+// parseRootCertificates parses the PEM encoded certificates in the given data.
+func parseRootCertificates(data []byte) ([]*x509.Certificate, error) {
+	var roots []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
 		if err != nil {
 			return nil, err
 		}
+
+		roots = append(roots, cert)
 	}
 
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	if len(roots) == 0 {
+		return nil, ErrNoRootCertificates
+	}
+
+	return roots, nil
+}
+
+// loadP12 creates a certificate from the given P12 data. Both legacy and modern
+// (AES/PBKDF2) encrypted bundles are supported and the presented certificate
+// contains the leaf certificate followed by its intermediates.
+func loadP12(p12 []byte, passphrase string) (tls.Certificate, error) {
+	key, leaf, caCerts, err := pkcs12.DecodeChain(p12, passphrase)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+
+	for _, c := range certificateChain(leaf, caCerts) {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return cert, nil
+}
+
+// certificateChain returns the intermediates from the given certificates in order,
+// starting with the issuer of the given leaf certificate. Self-signed root
+// certificates are not included since the server already trusts them.
+func certificateChain(leaf *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+
+	for current := leaf; len(chain) < len(certs); {
+		var issuer *x509.Certificate
+
+		for _, c := range certs {
+			if c != current && bytes.Equal(c.RawSubject, current.RawIssuer) {
+				issuer = c
+				break
+			}
+		}
+
+		if issuer == nil || bytes.Equal(issuer.RawSubject, issuer.RawIssuer) {
+			break
+		}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
+		chain = append(chain, issuer)
+		current = issuer
 	}
 
-	return tlsConfig, nil
+	return chain
+}
+
+// loadKeyPair creates a certificate from the given PEM encoded certificate chain and private key.
+// Encrypted PKCS#8 private keys are decrypted with the given passphrase.
+func loadKeyPair(certPEM, keyPEM []byte, passphrase string) (tls.Certificate, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block != nil && block.Type == "ENCRYPTED PRIVATE KEY" {
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
 }
 
 // createRequest will create a http request with given method to the given endpoint with the given data.
 func (s *Client) createRequest(ctx context.Context, method, endpoint string, data interface{}) (*http.Response, error) {
+	return s.createVersionRequest(ctx, APIVersion1, method, endpoint, data)
+}
+
+// createVersionRequest will create a http request with given method to the given endpoint
+// of the given version of the Swish API with the given data.
+func (s *Client) createVersionRequest(ctx context.Context, version, method, endpoint string, data interface{}) (res *http.Response, err error) {
 	var body io.Reader
+	var payload []byte
+	var errorCodes []string
+
+	if s.Audit != nil {
+		start := time.Now()
+
+		defer func() {
+			s.audit(ctx, &AuditRecord{
+				Time:       start,
+				Method:     method,
+				Endpoint:   endpoint,
+				Payload:    redactPayload(payload),
+				ErrorCodes: errorCodes,
+				Latency:    time.Since(start),
+			}, res, err)
+		}()
+	}
 
 	if data != nil {
 		j, err := json.Marshal(data)
@@ -130,19 +495,56 @@ func (s *Client) createRequest(ctx context.Context, method, endpoint string, dat
 			return nil, err
 		}
 
+		payload = j
 		body = bytes.NewBuffer(j)
 	}
 
-	req, err := http.NewRequest(method, s.URL()+endpoint, body)
+	req, err := http.NewRequest(method, s.versionURL(version)+endpoint, body)
 
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json")
 
-	res, err := s.Client.Do(req.WithContext(ctx))
+	// Swish API uses PATCH with JSON patch documents.
+	if method == "PATCH" {
+		req.Header.Add("Content-Type", "application/json-patch+json")
+	} else {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	setMetadataHeaders(ctx, req)
+
+	var probe bool
+
+	if s.breaker != nil {
+		if probe, err = s.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := s.waitLimit(ctx, endpoint)
+	if err == nil && ctx.Err() != nil {
+		// A context that is done before the request is sent says nothing about Swish API.
+		release()
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		if s.breaker != nil {
+			s.breaker.done(probe, breakerIgnore)
+		}
+
+		return nil, err
+	}
+
+	res, err = s.Client.Do(req.WithContext(ctx))
+	release()
+
+	if s.breaker != nil {
+		s.breaker.done(probe, breakerOutcome(ctx, res, err))
+	}
 
 	if err != nil {
 		// If we got an error, and the context has been canceled,
@@ -161,6 +563,14 @@ func (s *Client) createRequest(ctx context.Context, method, endpoint string, dat
 
 		readChuncked(res, &errs)
 
+		for _, e := range errs {
+			errorCodes = append(errorCodes, e.ErrorCode)
+		}
+
+		if codes, ok := ctx.Value(errorCodesKey{}).(*[]string); ok {
+			*codes = errorCodes
+		}
+
 		if len(errs) > 0 {
 			return res, errors.New(errs[0].ErrorMessage)
 		}
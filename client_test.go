@@ -0,0 +1,213 @@
+package swish
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestNewClientDoesNotModifySharedTransport(t *testing.T) {
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, defaultTransport.TLSClientConfig == nil || len(defaultTransport.TLSClientConfig.Certificates) == 0)
+	assert.True(t, client.Client != http.DefaultClient)
+	assert.True(t, client.Client.Transport != http.DefaultTransport)
+	assert.NotNil(t, client.Client.Transport.(*http.Transport).TLSClientConfig)
+}
+
+func TestNewClientWithCustomClient(t *testing.T) {
+	transport := &http.Transport{}
+	base := &http.Client{
+		Transport: transport,
+		Timeout:   5 * time.Second,
+	}
+
+	opts := &Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Client:     base,
+	}
+
+	first, err := NewClient(opts)
+	assert.Nil(t, err)
+
+	second, err := NewClient(opts)
+	assert.Nil(t, err)
+
+	assert.True(t, opts.Client == base)
+	assert.True(t, base.Transport == transport)
+	assert.True(t, transport.TLSClientConfig == nil || len(transport.TLSClientConfig.Certificates) == 0)
+
+	assert.Equal(t, 5*time.Second, first.Client.Timeout)
+	assert.True(t, first.Client.Transport != second.Client.Transport)
+	assert.NotNil(t, first.Client.Transport.(*http.Transport).TLSClientConfig)
+}
+
+func TestConfigWithPEMCertificate(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	cert, err := loadP12(p12, "swish")
+	assert.Nil(t, err)
+
+	var certPEM []byte
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	assert.Nil(t, err)
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	encrypted, err := pkcs8.MarshalPrivateKey(cert.PrivateKey, []byte("secret"), nil)
+	assert.Nil(t, err)
+
+	encryptedKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})
+
+	tests := []struct {
+		description string
+		options     *Options
+		expectError bool
+	}{
+		{
+			description: "pem certificate and key",
+			options:     &Options{CertData: certPEM, KeyData: keyPEM},
+		},
+		{
+			description: "pem certificate and encrypted key",
+			options:     &Options{CertData: certPEM, KeyData: encryptedKeyPEM, Passphrase: "secret"},
+		},
+		{
+			description: "pem certificate and encrypted key with wrong passphrase",
+			options:     &Options{CertData: certPEM, KeyData: encryptedKeyPEM, Passphrase: "wrong"},
+			expectError: true,
+		},
+		{
+			description: "pre-built certificate",
+			options:     &Options{Certificate: &cert},
+		},
+	}
+
+	for _, test := range tests {
+		test.options.Root = "./certs/root.pem"
+
+		config, err := createTLSConfig(test.options)
+
+		if test.expectError {
+			assert.NotNil(t, err, test.description)
+			continue
+		}
+
+		assert.Nil(t, err, test.description)
+		assert.Equal(t, cert.Certificate, config.Certificates[0].Certificate, test.description)
+	}
+}
+
+func TestLoadModernP12(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	key, leaf, caCerts, err := pkcs12.DecodeChain(p12, "swish")
+	assert.Nil(t, err)
+
+	modern, err := pkcs12.Modern.Encode(key, leaf, caCerts, "swish")
+	assert.Nil(t, err)
+
+	legacyCert, err := loadP12(p12, "swish")
+	assert.Nil(t, err)
+
+	modernCert, err := loadP12(modern, "swish")
+	assert.Nil(t, err)
+
+	assert.Equal(t, legacyCert.Certificate, modernCert.Certificate)
+
+	// Leaf followed by the customer and bank intermediates, without the Swish root.
+	assert.Equal(t, 3, len(modernCert.Certificate))
+	assert.Equal(t, leaf.Raw, modernCert.Certificate[0])
+
+	intermediate, err := x509.ParseCertificate(modernCert.Certificate[1])
+	assert.Nil(t, err)
+	assert.Equal(t, leaf.Issuer.String(), intermediate.Subject.String())
+}
+
+func TestConfigRoots(t *testing.T) {
+	root, err := os.ReadFile("./certs/root.pem")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		description   string
+		options       *Options
+		expectedRoots int
+		expectedError error
+	}{
+		{
+			description:   "bundled test root",
+			options:       &Options{Env: "test"},
+			expectedRoots: 1,
+		},
+		{
+			description:   "no root in production",
+			options:       &Options{Env: "production"},
+			expectedError: ErrNoProductionRoot,
+		},
+		{
+			description:   "configured root",
+			options:       &Options{Env: "production", RootData: root},
+			expectedRoots: 1,
+		},
+		{
+			description:   "root without certificates",
+			options:       &Options{Env: "test", RootData: []byte("invalid")},
+			expectedError: ErrNoRootCertificates,
+		},
+	}
+
+	for _, test := range tests {
+		roots, err := loadRootCertificates(test.options)
+
+		assert.Equal(t, test.expectedError, err, test.description)
+		assert.Equal(t, test.expectedRoots, len(roots), test.description)
+	}
+
+	_, err = createTLSConfig(&Options{Env: "production", P12: "./certs/test.p12", Passphrase: "swish"})
+	assert.Equal(t, ErrNoProductionRoot, err)
+}
+
+func TestConfigPinnedPublicKeys(t *testing.T) {
+	roots, err := loadRootCertificates(&Options{Root: "./certs/root.pem"})
+	assert.Nil(t, err)
+
+	hash := sha256.Sum256(roots[0].RawSubjectPublicKeyInfo)
+
+	config, err := createTLSConfig(&Options{
+		Env:              "test",
+		P12:              "./certs/test.p12",
+		Passphrase:       "swish",
+		PinnedPublicKeys: []string{base64.StdEncoding.EncodeToString(hash[:])},
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, config.VerifyConnection(tls.ConnectionState{PeerCertificates: roots}))
+	assert.Equal(t, ErrPublicKeyNotPinned, config.VerifyConnection(tls.ConnectionState{}))
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frozzare/go-swish"
+)
+
+// create creates a payment request.
+func create(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("create")
+	req := &swish.PaymentRequest{}
+
+	f.StringVar(&req.PayeeAlias, "payee", "", "payee alias, the merchant's Swish number")
+	f.StringVar(&req.PayerAlias, "payer", "", "payer alias, the payer's phone number")
+	f.StringVar(&req.Amount, "amount", "", "amount, like 100.00")
+	f.StringVar(&req.Currency, "currency", "SEK", "currency")
+	f.StringVar(&req.Message, "message", "", "message to the payer")
+	f.StringVar(&req.CallbackURL, "callback", "", "callback URL")
+	f.StringVar(&req.PayeePaymentReference, "reference", "", "payee payment reference")
+	f.StringVar(&req.PayerSSN, "payer-ssn", "", "social security number of the person that must pay, requires -api-version v2")
+	f.IntVar(&req.AgeLimit, "age-limit", 0, "minimum age of the payer, 1 to 99, requires -api-version v2")
+
+	if _, err := f.parse(args, 0); err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.CreatePaymentRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return f.write(stdout, res)
+}
+
+// get gets a payment request.
+func get(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("get")
+
+	args, err := f.parse(args, 1, "id")
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.PaymentRequest(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return f.write(stdout, res)
+}
+
+// cancel cancels a payment request.
+func cancel(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("cancel")
+
+	args, err := f.parse(args, 1, "id")
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.CancelPaymentRequest(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return f.write(stdout, res)
+}
+
+// refund creates a refund.
+func refund(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("refund")
+	req := &swish.PaymentRequest{}
+
+	f.StringVar(&req.OriginalPaymentReference, "original", "", "payment reference of the original payment")
+	f.StringVar(&req.PayerAlias, "payer", "", "payer alias, the merchant's Swish number")
+	f.StringVar(&req.Amount, "amount", "", "amount, like 100.00")
+	f.StringVar(&req.Currency, "currency", "SEK", "currency")
+	f.StringVar(&req.Message, "message", "", "message to the payee")
+	f.StringVar(&req.CallbackURL, "callback", "", "callback URL")
+	f.StringVar(&req.PayerPaymentReference, "reference", "", "payer payment reference")
+
+	if _, err := f.parse(args, 0); err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.CreateRefundRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return f.write(stdout, res)
+}
+
+// getRefund gets a refund.
+func getRefund(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("get-refund")
+
+	args, err := f.parse(args, 1, "id")
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	res, err := client.RefundRequest(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return f.write(stdout, res)
+}
+
+// cert inspects the client certificate.
+func cert(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("cert")
+
+	if _, err := f.parse(args, 0); err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	info, err := client.CertificateInfo()
+	if err != nil {
+		return err
+	}
+
+	return f.write(stdout, info)
+}
+
+// qr writes the QR code for a payment request token to stdout or a file. The token is returned
+// by create for payment requests without a payer alias.
+func qr(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("qr")
+	opts := &swish.QRCode{}
+
+	f.StringVar(&opts.Format, "format", "png", "image format, png, jpg or svg")
+	f.IntVar(&opts.Size, "size", 300, "width and height in pixels, not used with svg")
+	f.IntVar(&opts.Border, "border", 0, "width of the border in modules")
+	f.BoolVar(&opts.Transparent, "transparent", false, "transparent background, png only")
+	out := f.String("out", "", "file to write the image to, stdout when empty")
+
+	args, err := f.parse(args, 1, "token")
+	if err != nil {
+		return err
+	}
+
+	image, err := swish.QRCodeImage(ctx, args[0], opts)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		return os.WriteFile(*out, image, 0644)
+	}
+
+	_, err = stdout.Write(image)
+
+	return err
+}
+
+// listen starts a callback server, creates a payment request with a callback URL to the
+// server and writes the callbacks to stdout until interrupted.
+func listen(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("listen")
+	req := &swish.PaymentRequest{}
+
+	addr := f.String("addr", ":5000", "address to listen on")
+	publicURL := f.String("url", "", "public https URL of the callback server, like a tunnel URL, required unless -no-create is set")
+	noCreate := f.Bool("no-create", false, "only listen for callbacks without creating a payment request")
+
+	f.StringVar(&req.PayeeAlias, "payee", "", "payee alias, the merchant's Swish number")
+	f.StringVar(&req.PayerAlias, "payer", "", "payer alias, the payer's phone number")
+	f.StringVar(&req.Amount, "amount", "", "amount, like 100.00")
+	f.StringVar(&req.Currency, "currency", "SEK", "currency")
+	f.StringVar(&req.Message, "message", "", "message to the payer")
+	f.StringVar(&req.PayeePaymentReference, "reference", "", "payee payment reference")
+
+	if _, err := f.parse(args, 0); err != nil {
+		return err
+	}
+
+	// Swish only sends callbacks to https URLs that it can reach.
+	if !*noCreate && !strings.HasPrefix(*publicURL, "https://") {
+		fmt.Fprintln(f.Output(), "Usage: swish listen -url <https URL> [flags], -url is required unless -no-create is set")
+		f.PrintDefaults()
+
+		return errUsage
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	base := *publicURL
+	if base == "" {
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		base = "http://localhost:" + port
+	}
+
+	req.CallbackURL = strings.TrimSuffix(base, "/") + "/callback"
+
+	fmt.Fprintf(os.Stderr, "Listening for callbacks on %s\n", req.CallbackURL)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serveCallbacks(ctx, listener, func(cb *swish.Callback) error {
+			return f.write(stdout, cb)
+		})
+	}()
+
+	if !*noCreate {
+		client, err := f.client()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		res, err := client.CreatePaymentRequest(ctx, req)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		if err := f.write(stdout, res); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	return <-errs
+}
+
+// serveCallbacks serves Swish callbacks on the given listener and passes them to fn,
+// one at a time, until the context is done.
+func serveCallbacks(ctx context.Context, listener net.Listener, fn func(*swish.Callback) error) error {
+	var mu sync.Mutex
+
+	mux := http.NewServeMux()
+	mux.Handle("/callback", &swish.CallbackHandler{
+		OnCallback: func(ctx context.Context, cb *swish.Callback) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return fn(cb)
+		},
+	})
+
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// batchSummary represents the number of refunds in a batch by result.
+type batchSummary struct {
+	Created int    `json:"created"`
+	Failed  int    `json:"failed"`
+	Invalid int    `json:"invalid"`
+	Skipped int    `json:"skipped"`
+	Results string `json:"results"`
+}
+
+// refundBatch creates the refunds in a CSV or JSONL file and appends the results to a
+// results file. Refunds that are created in the results file are skipped, so an
+// interrupted batch is resumed by running the command again.
+func refundBatch(ctx context.Context, args []string, stdout io.Writer) error {
+	f := newFlags("refund-batch")
+
+	format := f.String("format", "", "format of the file, csv or jsonl, from the file extension when empty")
+	resultsFile := f.String("results", "", "results file, the file with .results.jsonl added when empty")
+	concurrency := f.Int("concurrency", 1, "maximum number of refunds sent at the same time")
+	interval := f.Duration("interval", 0, "minimum time between sending two refunds, like 200ms")
+
+	args, err := f.parse(args, 1, "file")
+	if err != nil {
+		return err
+	}
+
+	file := args[0]
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+
+	if *resultsFile == "" {
+		*resultsFile = file + ".results.jsonl"
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	instructions, err := swish.ReadRefundInstructions(in, *format)
+	in.Close()
+
+	if err != nil {
+		return err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	batch := &swish.RefundBatch{
+		Client:      client,
+		Concurrency: *concurrency,
+		Interval:    *interval,
+	}
+
+	out, err := os.OpenFile(*resultsFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	results, err := swish.ReadRefundResults(out)
+	if err != nil {
+		return err
+	}
+
+	batch.Complete(results)
+
+	summary := &batchSummary{
+		Skipped: len(instructions),
+		Results: *resultsFile,
+	}
+
+	enc := json.NewEncoder(out)
+
+	err = batch.Run(ctx, instructions, func(result *swish.RefundResult) error {
+		summary.Skipped--
+
+		switch result.Status {
+		case swish.BatchStatusCreated:
+			summary.Created++
+		case swish.BatchStatusFailed:
+			summary.Failed++
+		case swish.BatchStatusInvalid:
+			summary.Invalid++
+		}
+
+		return enc.Encode(result)
+	})
+
+	if werr := f.write(stdout, summary); err == nil {
+		err = werr
+	}
+
+	return err
+}
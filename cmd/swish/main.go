@@ -0,0 +1,329 @@
+// Command swish is a command line tool for the Swish merchant API.
+//
+// Credentials are read from a JSON config file, SWISH_* environment variables and flags,
+// where flags take precedence over environment variables and environment variables over
+// the config file.
+//
+// Usage:
+//
+//	swish <command> [flags]
+//
+// Commands:
+//
+//	create        create a payment request
+//	get           get a payment request
+//	cancel        cancel a payment request
+//	refund        create a refund
+//	get-refund    get a refund
+//	cert          inspect the client certificate
+//	listen        create a payment request and print its callbacks
+//	refund-batch  create the refunds in a CSV or JSONL file
+//	qr            generate the QR code for a payment request token
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/frozzare/go-swish"
+)
+
+// command represents a subcommand.
+type command struct {
+	description string
+	run         func(ctx context.Context, args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"create":       {"create a payment request", create},
+	"get":          {"get a payment request", get},
+	"cancel":       {"cancel a payment request", cancel},
+	"refund":       {"create a refund", refund},
+	"get-refund":   {"get a refund", getRefund},
+	"cert":         {"inspect the client certificate", cert},
+	"listen":       {"create a payment request and print its callbacks", listen},
+	"refund-batch": {"create the refunds in a CSV or JSONL file", refundBatch},
+	"qr":           {"generate the QR code for a payment request token", qr},
+}
+
+// errUsage is the error when a command is used incorrectly, the usage has already been printed.
+var errUsage = errors.New("usage")
+
+// errKeyWithoutCert is the error when a key is given without a certificate.
+var errKeyWithoutCert = errors.New("A key must be given together with a PEM certificate")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+
+	os.Exit(code)
+}
+
+// run runs the command in the given arguments and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "swish: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	if err := cmd.run(ctx, args[1:], stdout); err != nil {
+		if err == errUsage || err == flag.ErrHelp {
+			return 2
+		}
+
+		fmt.Fprintf(stderr, "swish: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// usage prints the commands.
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage: swish <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].description)
+	}
+
+	tw.Flush()
+}
+
+// config represents the config file and the credential flags.
+type config struct {
+	Env        string `json:"env"`
+	P12        string `json:"p12"`
+	Passphrase string `json:"passphrase"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	Root       string `json:"root"`
+	APIVersion string `json:"apiVersion"`
+}
+
+// flags represents the flags shared by all commands.
+type flags struct {
+	*flag.FlagSet
+
+	config string
+	output string
+	creds  config
+}
+
+// newFlags creates a flag set with the shared flags.
+func newFlags(name string) *flags {
+	f := &flags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+
+	f.StringVar(&f.config, "config", os.Getenv("SWISH_CONFIG"), "JSON config file with env, p12, passphrase, cert, key, root and apiVersion")
+	f.StringVar(&f.output, "output", "json", "output format, json or table")
+	f.StringVar(&f.creds.Env, "env", "", "Swish environment, test or production")
+	f.StringVar(&f.creds.P12, "p12", "", "P12 file")
+	f.StringVar(&f.creds.Passphrase, "passphrase", "", "passphrase for the P12 or key")
+	f.StringVar(&f.creds.Cert, "cert", "", "PEM certificate file")
+	f.StringVar(&f.creds.Key, "key", "", "PEM key file")
+	f.StringVar(&f.creds.Root, "root", "", "root certificate file")
+	f.StringVar(&f.creds.APIVersion, "api-version", "", "Swish API version used to create payment requests and refunds, v1 or v2")
+
+	return f
+}
+
+// parse parses the arguments and returns the positional arguments, which must be exactly n.
+func (f *flags) parse(args []string, n int, names ...string) ([]string, error) {
+	if err := f.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if f.NArg() != n {
+		fmt.Fprintf(f.Output(), "Usage: swish %s [flags]", f.Name())
+		for _, name := range names {
+			fmt.Fprintf(f.Output(), " <%s>", name)
+		}
+
+		fmt.Fprintln(f.Output())
+		f.PrintDefaults()
+
+		return nil, errUsage
+	}
+
+	return f.Args(), nil
+}
+
+// options returns the client options from the config file, environment variables and flags.
+func (f *flags) options() (*swish.Options, error) {
+	opts := &swish.Options{}
+
+	if f.config != "" {
+		data, err := os.ReadFile(f.config)
+		if err != nil {
+			return nil, err
+		}
+
+		var c config
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("Invalid config file %s: %s", f.config, err)
+		}
+
+		if opts, err = c.apply(opts); err != nil {
+			return nil, fmt.Errorf("Invalid config file %s: %s", f.config, err)
+		}
+	}
+
+	env, err := swish.OptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := merge(opts, env); err != nil {
+		return nil, err
+	}
+
+	if opts, err = f.creds.apply(opts); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// apply returns the options with the non-empty values from the config.
+func (c config) apply(opts *swish.Options) (*swish.Options, error) {
+	err := merge(opts, &swish.Options{
+		Env:        c.Env,
+		P12:        c.P12,
+		Passphrase: c.Passphrase,
+		Cert:       c.Cert,
+		Key:        c.Key,
+		Root:       c.Root,
+		APIVersion: c.APIVersion,
+	})
+
+	return opts, err
+}
+
+// merge sets the non-empty credentials from src on dst. A certificate or key replaces any
+// certificate or key in dst, so a P12 from the environment is not mixed with a PEM key from
+// the config file, and a root replaces the root in dst whether it is a file or data.
+func merge(dst, src *swish.Options) error {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&dst.Env, src.Env},
+		{&dst.Passphrase, src.Passphrase},
+		{&dst.Root, src.Root},
+		{&dst.APIVersion, src.APIVersion},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+
+	if src.Root != "" {
+		dst.RootData = nil
+	}
+
+	if src.RootData != nil {
+		dst.Root, dst.RootData = "", src.RootData
+	}
+
+	hasCert := src.Cert != "" || src.CertData != nil
+
+	if (src.Key != "" || src.KeyData != nil) && !hasCert {
+		return errKeyWithoutCert
+	}
+
+	if src.P12 != "" || src.P12Data != nil || hasCert {
+		dst.P12, dst.P12Data = src.P12, src.P12Data
+		dst.Cert, dst.CertData = src.Cert, src.CertData
+		dst.Key, dst.KeyData = src.Key, src.KeyData
+	}
+
+	return nil
+}
+
+// client creates a client from the flags.
+func (f *flags) client() (*swish.Client, error) {
+	opts, err := f.options()
+	if err != nil {
+		return nil, err
+	}
+
+	return swish.NewClient(opts)
+}
+
+// write writes the given value as JSON or a table.
+func (f *flags) write(w io.Writer, v interface{}) error {
+	switch f.output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	case "table":
+		return writeTable(w, v)
+	default:
+		return fmt.Errorf("Unknown output format: %s", f.output)
+	}
+}
+
+// writeTable writes the fields of the given value as a table with one field per row.
+func writeTable(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		value := fields[name]
+
+		if _, ok := value.(string); !ok {
+			j, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			value = string(j)
+		}
+
+		fmt.Fprintf(tw, "%s\t%v\n", name, value)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+	"github.com/frozzare/go-swish"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestOptions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "swish.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"env":"production","cert":"cert.pem","key":"key.pem","passphrase":"config"}`), 0600))
+
+	t.Setenv("SWISH_P12_BASE64", base64.StdEncoding.EncodeToString([]byte("p12")))
+	t.Setenv("SWISH_PASSPHRASE", "env")
+
+	f := newFlags("test")
+	_, err := f.parse([]string{"-config", file, "-env", "test"}, 0)
+	assert.Nil(t, err)
+
+	opts, err := f.options()
+	assert.Nil(t, err)
+
+	assert.Equal(t, &swish.Options{
+		Env:        "test",
+		P12Data:    []byte("p12"),
+		Passphrase: "env",
+	}, opts)
+}
+
+func TestOptionsPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "swish.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"root":"config.pem"}`), 0600))
+
+	t.Setenv("SWISH_ROOT_BASE64", base64.StdEncoding.EncodeToString([]byte("env")))
+
+	tests := []struct {
+		description string
+		args        []string
+		expected    *swish.Options
+		err         error
+	}{
+		{"env overrides config", []string{"-config", file}, &swish.Options{RootData: []byte("env")}, nil},
+		{"flag overrides env", []string{"-config", file, "-root", "flag.pem"}, &swish.Options{Root: "flag.pem"}, nil},
+		{"key without cert", []string{"-key", "key.pem"}, nil, errKeyWithoutCert},
+	}
+
+	for _, test := range tests {
+		f := newFlags("test")
+		_, err := f.parse(test.args, 0)
+		assert.Nil(t, err, test.description)
+
+		opts, err := f.options()
+		assert.Equal(t, test.err, err, test.description)
+		assert.Equal(t, test.expected, opts, test.description)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), []string{"cert", "-p12", "../../certs/test.p12", "-passphrase", "swish", "-root", "../../certs/root.pem"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.True(t, strings.Contains(stdout.String(), `"swishNumber": "1231181189"`))
+
+	stdout.Reset()
+
+	code = run(context.Background(), []string{"cert", "-p12", "../../certs/test.p12", "-passphrase", "swish", "-output", "table"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.True(t, strings.Contains(stdout.String(), "swishNumber         1231181189\n"))
+
+	code = run(context.Background(), []string{"unknown"}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+
+	code = run(context.Background(), []string{"get"}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+
+	code = run(context.Background(), []string{"get", "-p12", "missing.p12", "AB23D7406ECE4542A80152D909EF9F6B"}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+}
+
+func TestServeCallbacks(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	callbacks := make(chan *swish.Callback, 1)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- serveCallbacks(ctx, listener, func(cb *swish.Callback) error {
+			callbacks <- cb
+			return nil
+		})
+	}()
+
+	res, err := http.Post("http://"+listener.Addr().String()+"/callback", "application/json",
+		strings.NewReader(`{"id":"AB23D7406ECE4542A80152D909EF9F6B","status":"PAID","amount":"100.00"}`))
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	cb := <-callbacks
+	assert.Equal(t, swish.TypePaymentRequest, cb.Type)
+	assert.Equal(t, "AB23D7406ECE4542A80152D909EF9F6B", cb.ID)
+	assert.Equal(t, swish.StatusPaid, cb.Status)
+
+	cancel()
+	assert.Nil(t, <-errs)
+}
+
+func TestRefundBatch(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	sent := 0
+
+	httpmock.RegisterResponder("PUT", "https://mss.cpc.getswish.net/swish-cpcapi/api/v2/refunds/A0000000000000000000000000000001", func(req *http.Request) (*http.Response, error) {
+		sent++
+
+		return httpmock.NewStringResponse(201, ""), nil
+	})
+
+	file := filepath.Join(t.TempDir(), "refunds.csv")
+	assert.Nil(t, os.WriteFile(file, []byte("instructionUUID,originalPaymentReference,amount\n"+
+		"A0000000000000000000000000000001,ref1,100.00\n"+
+		"A0000000000000000000000000000002,,100.00\n"), 0600))
+
+	args := []string{"refund-batch", "-p12", "../../certs/test.p12", "-passphrase", "swish", "-root", "../../certs/root.pem", file}
+
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), args, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, 1, sent)
+	assert.True(t, strings.Contains(stdout.String(), `"created": 1`))
+	assert.True(t, strings.Contains(stdout.String(), `"invalid": 1`))
+
+	stdout.Reset()
+
+	code = run(context.Background(), args, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, 1, sent)
+	assert.True(t, strings.Contains(stdout.String(), `"skipped": 1`))
+
+	data, err := os.ReadFile(file + ".results.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+}
+
+func TestListenURL(t *testing.T) {
+	tests := []struct {
+		description string
+		args        []string
+		expected    int
+	}{
+		{"no url", []string{"listen", "-addr", "127.0.0.1:0"}, 2},
+		{"http url", []string{"listen", "-addr", "127.0.0.1:0", "-url", "http://abc123.ngrok.io"}, 2},
+		{"no url without creating", []string{"listen", "-addr", "127.0.0.1:0", "-no-create"}, 0},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		code := run(ctx, test.args, &stdout, &stderr)
+		assert.Equal(t, test.expected, code, test.description)
+	}
+}
+
+func TestQR(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", swish.QRCodeURL, func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, "image"), nil
+	})
+
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), []string{"qr", "c28a4061470f4af48973bd2a4642b4fa"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "image", stdout.String())
+
+	file := filepath.Join(t.TempDir(), "qr.png")
+
+	code = run(context.Background(), []string{"qr", "-out", file, "c28a4061470f4af48973bd2a4642b4fa"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "image", string(data))
+
+	code = run(context.Background(), []string{"qr"}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+}
@@ -0,0 +1,67 @@
+package swish
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DedupStore represents a store of claimed callbacks, used to process each payment request
+// and refund status change once even when Swish delivers a callback multiple times.
+type DedupStore interface {
+	// Claim claims the given key for the given duration and returns false if it is already claimed.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Release releases the given key so it can be claimed again.
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryDedupStore represents a dedup store that keeps claimed keys in memory.
+type MemoryDedupStore struct {
+	mu        sync.Mutex
+	claims    map[string]time.Time
+	lastPurge time.Time
+}
+
+// NewMemoryDedupStore creates a new empty memory dedup store.
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{
+		claims: make(map[string]time.Time),
+	}
+}
+
+// Claim claims the given key for the given duration and returns false if it is already claimed.
+func (s *MemoryDedupStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Remove expired claims at most once a minute.
+	if now.Sub(s.lastPurge) > time.Minute {
+		for k, expires := range s.claims {
+			if now.After(expires) {
+				delete(s.claims, k)
+			}
+		}
+
+		s.lastPurge = now
+	}
+
+	if expires, ok := s.claims[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+
+	s.claims[key] = now.Add(ttl)
+
+	return true, nil
+}
+
+// Release releases the given key so it can be claimed again.
+func (s *MemoryDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claims, key)
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	store := NewMemoryDedupStore()
+
+	claimed, err := store.Claim(context.Background(), "key", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = store.Claim(context.Background(), "key", time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, claimed)
+
+	assert.Nil(t, store.Release(context.Background(), "key"))
+
+	claimed, err = store.Claim(context.Background(), "key", -time.Second)
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+
+	// The claim has expired.
+	claimed, err = store.Claim(context.Background(), "key", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+}
+
+func TestCallbackHandlerDedup(t *testing.T) {
+	var paid, created int32
+	var fail atomic.Bool
+
+	handler := &CallbackHandler{
+		Dedup: NewMemoryDedupStore(),
+		OnPaid: func(ctx context.Context, cb *Callback) error {
+			if fail.Load() {
+				return errors.New("failed")
+			}
+
+			atomic.AddInt32(&paid, 1)
+			return nil
+		},
+		OnCallback: func(ctx context.Context, cb *Callback) error {
+			if cb.Status == StatusCreated {
+				atomic.AddInt32(&created, 1)
+			}
+
+			return nil
+		},
+	}
+
+	deliver := func(status string) int {
+		rec := httptest.NewRecorder()
+		body := `{"id":"AB23D7406ECE4542A80152D909EF9F6B","amount":"100","status":"` + status + `"}`
+
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/callback", strings.NewReader(body)))
+
+		return rec.Code
+	}
+
+	fail.Store(true)
+	assert.Equal(t, 500, deliver(StatusPaid))
+	fail.Store(false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, 200, deliver(StatusPaid))
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 200, deliver(StatusCreated))
+	assert.Equal(t, 200, deliver(StatusCreated))
+
+	assert.Equal(t, int32(1), paid)
+	assert.Equal(t, int32(1), created)
+}
+
+func TestCallbackHandlerDefaultDedup(t *testing.T) {
+	tests := []struct {
+		description  string
+		disableDedup bool
+		expected     int
+	}{
+		{"memory dedup store by default", false, 1},
+		{"dedup disabled", true, 2},
+	}
+
+	for _, test := range tests {
+		paid := 0
+
+		handler := &CallbackHandler{
+			DisableDedup: test.disableDedup,
+			OnPaid: func(ctx context.Context, cb *Callback) error {
+				paid++
+				return nil
+			},
+		}
+
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/callback", strings.NewReader(`{"id":"AB23D7406ECE4542A80152D909EF9F6B","status":"PAID"}`)))
+
+			assert.Equal(t, 200, rec.Code, test.description)
+		}
+
+		assert.Equal(t, test.expected, paid, test.description)
+	}
+}
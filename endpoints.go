@@ -2,23 +2,58 @@ package swish
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
-
+	"regexp"
 	"strings"
 )
 
+// Versions of the Swish API.
+const (
+	// APIVersion1 creates payment requests and refunds with POST and gets the ID from Swish.
+	APIVersion1 = "v1"
+	// APIVersion2 creates payment requests and refunds with PUT to an instruction UUID chosen by
+	// the client, so a request that is sent again does not create a second payment or refund.
+	APIVersion2 = "v2"
+)
+
 var (
 	// ErrNoLocationHeader is the error when no location header exists in the response from Swish API.
 	ErrNoLocationHeader = errors.New("Error: No location header from Swish API")
+
+	// ErrPayerRestrictionsVersion is the error when PayerSSN or AgeLimit is used without APIVersion2.
+	ErrPayerRestrictionsVersion = errors.New("Error: Payer SSN and age limit require APIVersion2")
+
+	// ErrInvalidPayerSSN is the error when a payer SSN is not 12 digits.
+	ErrInvalidPayerSSN = errors.New("Error: Payer SSN must be 12 digits, like 199001011234")
+
+	// ErrInvalidAgeLimit is the error when an age limit is not between 1 and 99.
+	ErrInvalidAgeLimit = errors.New("Error: Age limit must be between 1 and 99")
 )
 
+// payerSSN matches social security numbers as used by Swish API, YYYYMMDDNNNN.
+var payerSSN = regexp.MustCompile(`^[0-9]{12}$`)
+
 // PaymentRequest represents a payment request from Swish API.
+//
+// ID is assigned by Swish with APIVersion1 and is the instruction UUID chosen by the client
+// with APIVersion2, the same for payment requests and refunds. PaymentReference is set by
+// Swish once the payment or refund is paid in both versions and is the reference refunds use
+// as original payment reference.
+//
+// PayerSSN and AgeLimit restrict who can pay, the payment must be made by the person with the
+// social security number or by a person with at least the age. They are only accepted by
+// APIVersion2 and payment requests that use them with APIVersion1 are rejected before they are
+// sent. PayerSSN is never audited.
 type PaymentRequest struct {
 	AdditionalInformation    string `json:"additionalInformation,omitempty"`
+	AgeLimit                 int    `json:"ageLimit,omitempty"`
 	Amount                   string `json:"amount,omitempty"`
 	CallbackURL              string `json:"callbackUrl,omitempty"`
+	CallbackIdentifier       string `json:"callbackIdentifier,omitempty"`
 	Currency                 string `json:"currency,omitempty"`
 	DateCreated              string `json:"dateCreated,omitempty"`
 	DatePaid                 string `json:"datePaid,omitempty"`
@@ -30,31 +65,59 @@ type PaymentRequest struct {
 	PayeePaymentReference    string `json:"payeePaymentReference,omitempty"`
 	PayerPaymentReference    string `json:"payerPaymentReference,omitempty"`
 	PayerAlias               string `json:"payerAlias,omitempty"`
+	PayerSSN                 string `json:"payerSSN,omitempty"`
 	PaymentReference         string `json:"paymentReference,omitempty"`
+	PaymentRequestToken      string `json:"paymentRequestToken,omitempty"`
 	OriginalPaymentReference string `json:"originalPaymentReference,omitempty"`
 	Status                   string `json:"status,omitempty"`
 }
 
 // CreatePaymentRequest will create a payment request to Swish and return a payment
 // request containing the ID of the request and the data sent to Swish or a error.
+// Empty fields are filled from the merchant profile, if any.
 func (c *Client) CreatePaymentRequest(ctx context.Context, req *PaymentRequest) (*PaymentRequest, error) {
-	res, err := c.createRequest(ctx, "POST", "/paymentrequests", req)
+	if err := c.applyMerchant(ctx, TypePaymentRequest, req); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := validatePayerRestrictions(c.APIVersion, req); err != nil {
 		return nil, err
 	}
 
-	if len(res.Header.Get("Location")) == 0 {
-		return nil, ErrNoLocationHeader
+	reqCtx, cancel := withTimeout(ctx, c.Timeouts.CreatePaymentRequest)
+	defer cancel()
+
+	id, err := c.create(reqCtx, c.APIVersion, "/paymentrequests", req)
+
+	if err != nil {
+		return nil, err
 	}
 
-	req.ID = strings.Replace(res.Header.Get("Location"), c.URL()+"/paymentrequests/", "", -1)
+	req.ID = id
+
+	c.saveAndPublish(ctx, TypePaymentRequest, created(req))
 
 	return req, nil
 }
 
 // PaymentRequest will return a payment request or a error for the given id.
 func (c *Client) PaymentRequest(ctx context.Context, id string) (*PaymentRequest, error) {
+	paymentRequest, err := c.paymentRequest(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.save(ctx, TypePaymentRequest, paymentRequest)
+
+	return paymentRequest, nil
+}
+
+// paymentRequest will return a payment request or a error for the given id without saving it in the store.
+func (c *Client) paymentRequest(ctx context.Context, id string) (*PaymentRequest, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.PaymentRequest)
+	defer cancel()
+
 	res, err := c.createRequest(ctx, "GET", "/paymentrequests/"+id, nil)
 
 	if err != nil {
@@ -76,26 +139,80 @@ func (c *Client) PaymentRequest(ctx context.Context, id string) (*PaymentRequest
 	return paymentRequest, nil
 }
 
+// CancelPaymentRequest will cancel the payment request with the given id and return
+// the cancelled payment request or a error.
+func (c *Client) CancelPaymentRequest(ctx context.Context, id string) (*PaymentRequest, error) {
+	patch := []map[string]string{
+		{"op": "replace", "path": "/status", "value": "cancelled"},
+	}
+
+	reqCtx, cancel := withTimeout(ctx, c.Timeouts.CancelPaymentRequest)
+	defer cancel()
+
+	res, err := c.createRequest(reqCtx, "PATCH", "/paymentrequests/"+id, patch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var paymentRequest *PaymentRequest
+
+	if err := readChuncked(res, &paymentRequest); err != nil {
+		return nil, err
+	}
+
+	c.saveAndPublish(ctx, TypePaymentRequest, paymentRequest)
+
+	return paymentRequest, nil
+}
+
 // CreateRefundRequest will create a refund request to Swish and return a refund
 // request containing the ID of the request and the data sent to Swish or a error.
+// Empty fields are filled from the merchant profile, if any.
 func (c *Client) CreateRefundRequest(ctx context.Context, req *PaymentRequest) (*PaymentRequest, error) {
-	res, err := c.createRequest(ctx, "POST", "/refunds", req)
+	return c.createRefundRequest(ctx, c.APIVersion, req)
+}
 
-	if err != nil {
+// createRefundRequest will create a refund request with the given Swish API version.
+func (c *Client) createRefundRequest(ctx context.Context, version string, req *PaymentRequest) (*PaymentRequest, error) {
+	if err := c.applyMerchant(ctx, TypeRefund, req); err != nil {
 		return nil, err
 	}
 
-	if len(res.Header.Get("Location")) == 0 {
-		return nil, ErrNoLocationHeader
+	reqCtx, cancel := withTimeout(ctx, c.Timeouts.CreateRefundRequest)
+	defer cancel()
+
+	id, err := c.create(reqCtx, version, "/refunds", req)
+
+	if err != nil {
+		return nil, err
 	}
 
-	req.ID = strings.Replace(res.Header.Get("Location"), c.URL()+"/refunds/", "", -1)
+	req.ID = id
+
+	c.saveAndPublish(ctx, TypeRefund, created(req))
 
 	return req, nil
 }
 
 // RefundRequest will return a payment request or a error for the given id.
 func (c *Client) RefundRequest(ctx context.Context, id string) (*PaymentRequest, error) {
+	paymentRequest, err := c.refundRequest(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.save(ctx, TypeRefund, paymentRequest)
+
+	return paymentRequest, nil
+}
+
+// refundRequest will return a refund request or a error for the given id without saving it in the store.
+func (c *Client) refundRequest(ctx context.Context, id string) (*PaymentRequest, error) {
+	ctx, cancel := withTimeout(ctx, c.Timeouts.RefundRequest)
+	defer cancel()
+
 	res, err := c.createRequest(ctx, "GET", "/refunds/"+id, nil)
 
 	if err != nil {
@@ -114,3 +231,101 @@ func (c *Client) RefundRequest(ctx context.Context, id string) (*PaymentRequest,
 
 	return paymentRequest, nil
 }
+
+// create will create a payment request or refund at the given endpoint with the given Swish
+// API version and return its ID. With APIVersion2 the request's ID is used as instruction
+// UUID, or a new one when empty.
+func (c *Client) create(ctx context.Context, version, endpoint string, req *PaymentRequest) (string, error) {
+	// The payment request token is returned by Swish and not sent.
+	body := *req
+	body.PaymentRequestToken = ""
+
+	if version != APIVersion2 {
+		res, err := c.createRequest(ctx, "POST", endpoint, &body)
+
+		if err != nil {
+			return "", err
+		}
+
+		if len(res.Header.Get("Location")) == 0 {
+			return "", ErrNoLocationHeader
+		}
+
+		req.PaymentRequestToken = res.Header.Get(PaymentRequestTokenHeader)
+
+		return strings.Replace(res.Header.Get("Location"), c.URL()+endpoint+"/", "", -1), nil
+	}
+
+	id := strings.ToUpper(req.ID)
+	if id == "" {
+		var err error
+
+		if id, err = NewInstructionUUID(); err != nil {
+			return "", err
+		}
+	}
+
+	if !instructionUUID.MatchString(id) {
+		return "", ErrInvalidInstructionUUID
+	}
+
+	// The instruction UUID is sent in the URL and not in the body.
+	body.ID = ""
+
+	res, err := c.createVersionRequest(ctx, APIVersion2, "PUT", endpoint+"/"+id, &body)
+
+	if err != nil {
+		return "", err
+	}
+
+	res.Body.Close()
+
+	req.PaymentRequestToken = res.Header.Get(PaymentRequestTokenHeader)
+
+	return id, nil
+}
+
+// validatePayerRestrictions returns an error if the payment request's payer SSN or age limit
+// can not be sent with the given Swish API version.
+func validatePayerRestrictions(version string, req *PaymentRequest) error {
+	if req.PayerSSN == "" && req.AgeLimit == 0 {
+		return nil
+	}
+
+	if version != APIVersion2 {
+		return ErrPayerRestrictionsVersion
+	}
+
+	if req.PayerSSN != "" && !payerSSN.MatchString(req.PayerSSN) {
+		return ErrInvalidPayerSSN
+	}
+
+	if req.AgeLimit < 0 || req.AgeLimit > 99 {
+		return ErrInvalidAgeLimit
+	}
+
+	return nil
+}
+
+// NewInstructionUUID returns a new random instruction UUID, 32 uppercase hexadecimal characters.
+func NewInstructionUUID() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+// created returns a copy of the given payment request with the created status, as
+// it is stored before Swish reports any other status.
+func created(req *PaymentRequest) *PaymentRequest {
+	r := *req
+
+	if r.Status == "" {
+		r.Status = StatusCreated
+	}
+
+	return &r
+}
@@ -2,9 +2,11 @@ package swish
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/frozzare/go-assert"
@@ -44,6 +46,29 @@ func TestCreatePaymentRequest(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			description: "create payment request success with payment request token",
+			responder: func(req *http.Request) (*http.Response, error) {
+				resp := httpmock.NewStringResponse(201, "")
+
+				resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+				resp.Header.Set("PaymentRequestToken", "c28a4061470f4af48973bd2a4642b4fa")
+
+				return resp, nil
+			},
+			expectedResult: &PaymentRequest{
+				ID:                    "AB23D7406ECE4542A80152D909EF9F6B",
+				PayeePaymentReference: "0123456789",
+				CallbackURL:           "https://example.com/api/swishcb/paymentrequests",
+				PayerAlias:            "46701234567",
+				PayeeAlias:            "1234760039",
+				Amount:                "100",
+				Currency:              "SEK",
+				Message:               "Kingston USB Flash Drive 8 GB",
+				PaymentRequestToken:   "c28a4061470f4af48973bd2a4642b4fa",
+			},
+			expectedError: nil,
+		},
 		{
 			description: "create payment request failed - no location header",
 			responder: func(req *http.Request) (*http.Response, error) {
@@ -372,3 +397,204 @@ func TestConfigWithCertificateData(t *testing.T) {
 	// Assert both methods result in the same TLS config
 	assert.Equal(t, fileConfig.Certificates[0], dataConfig.Certificates[0])
 }
+
+func TestCancelPaymentRequest(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	tests := []struct {
+		description    string
+		responder      func(req *http.Request) (*http.Response, error)
+		expectedResult *PaymentRequest
+		expectedError  error
+	}{
+		{
+			description: "cancel payment request success",
+			responder: func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("Content-Type") != "application/json-patch+json" {
+					return httpmock.NewStringResponse(415, ""), nil
+				}
+
+				return httpmock.NewStringResponse(200, `
+                    {
+                        "id": "AB23D7406ECE4542A80152D909EF9F6B",
+                        "payeePaymentReference": "0123456789",
+                        "payeeAlias": "1234760039",
+                        "amount": "100",
+                        "currency": "SEK",
+                        "status": "CANCELLED"
+                    }
+                `), nil
+			},
+			expectedResult: &PaymentRequest{
+				ID:                    "AB23D7406ECE4542A80152D909EF9F6B",
+				PayeePaymentReference: "0123456789",
+				PayeeAlias:            "1234760039",
+				Amount:                "100",
+				Currency:              "SEK",
+				Status:                "CANCELLED",
+			},
+			expectedError: nil,
+		},
+		{
+			description: "cancel payment request failed - swish errors",
+			responder: func(req *http.Request) (*http.Response, error) {
+				return httpmock.NewStringResponse(422, `[{"errorCode":"RP07","errorMessage":"Transaction declined","additionalInformation":null}]`), nil
+			},
+			expectedResult: nil,
+			expectedError:  errors.New("Transaction declined"),
+		},
+	}
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+
+	assert.Nil(t, err)
+
+	for _, test := range tests {
+		httpmock.RegisterResponder("PATCH", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", test.responder)
+
+		res, err := client.CancelPaymentRequest(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+
+		assert.Equal(t, res, test.expectedResult, test.description)
+		assert.Equal(t, err, test.expectedError, test.description)
+
+		httpmock.Reset()
+	}
+}
+
+func TestCreateRequestsVersion2(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	var records []*AuditRecord
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		APIVersion: APIVersion2,
+		Audit: auditSinkFunc(func(ctx context.Context, record *AuditRecord) error {
+			records = append(records, record)
+			return nil
+		}),
+	})
+	assert.Nil(t, err)
+
+	bodies := make(map[string]map[string]interface{})
+
+	responder := func(req *http.Request) (*http.Response, error) {
+		if req.Method != "PUT" {
+			return httpmock.NewStringResponse(405, ""), nil
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		bodies[req.URL.Path] = body
+
+		return httpmock.NewStringResponse(201, ""), nil
+	}
+
+	httpmock.RegisterResponder("PUT", "https://mss.cpc.getswish.net/swish-cpcapi/api/v2/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", responder)
+	// The instruction UUID of the refund is generated, so refunds are handled by the no responder.
+	httpmock.RegisterNoResponder(responder)
+
+	req, err := client.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		ID:         "ab23d7406ece4542a80152d909ef9f6b",
+		PayeeAlias: "1234760039",
+		Amount:     "100",
+		Currency:   "SEK",
+		PayerSSN:   "199001011234",
+		AgeLimit:   18,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "AB23D7406ECE4542A80152D909EF9F6B", req.ID)
+
+	body := bodies["/swish-cpcapi/api/v2/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B"]
+	assert.Nil(t, body["id"])
+	assert.Equal(t, "199001011234", body["payerSSN"])
+	assert.Equal(t, float64(18), body["ageLimit"])
+
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "AB23D7406ECE4542A80152D909EF9F6B", records[0].InstructionID)
+	assert.False(t, strings.Contains(string(records[0].Payload), "199001011234"))
+
+	refund, err := client.CreateRefundRequest(context.Background(), &PaymentRequest{
+		OriginalPaymentReference: "6D6CD7406ECE4542A80152D909EF9F6B",
+		PayerAlias:               "1234760039",
+		Amount:                   "100",
+		Currency:                 "SEK",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(refund.ID))
+	assert.NotNil(t, bodies["/swish-cpcapi/api/v2/refunds/"+refund.ID])
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{ID: "invalid"})
+	assert.Equal(t, ErrInvalidInstructionUUID, err)
+}
+
+func TestValidatePayerRestrictions(t *testing.T) {
+	tests := []struct {
+		description   string
+		version       string
+		req           *PaymentRequest
+		expectedError error
+	}{
+		{"no restrictions with v1", APIVersion1, &PaymentRequest{}, nil},
+		{"payer SSN with v1", APIVersion1, &PaymentRequest{PayerSSN: "199001011234"}, ErrPayerRestrictionsVersion},
+		{"age limit without version", "", &PaymentRequest{AgeLimit: 18}, ErrPayerRestrictionsVersion},
+		{"payer SSN and age limit with v2", APIVersion2, &PaymentRequest{PayerSSN: "199001011234", AgeLimit: 18}, nil},
+		{"short payer SSN", APIVersion2, &PaymentRequest{PayerSSN: "9001011234"}, ErrInvalidPayerSSN},
+		{"payer SSN with dash", APIVersion2, &PaymentRequest{PayerSSN: "19900101-1234"}, ErrInvalidPayerSSN},
+		{"age limit too high", APIVersion2, &PaymentRequest{AgeLimit: 100}, ErrInvalidAgeLimit},
+		{"negative age limit", APIVersion2, &PaymentRequest{AgeLimit: -1}, ErrInvalidAgeLimit},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedError, validatePayerRestrictions(test.version, test.req), test.description)
+	}
+}
+
+func TestCreatePaymentRequestPayerRestrictionsVersion1(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+	assert.Nil(t, err)
+
+	sent := false
+
+	httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+		sent = true
+		return httpmock.NewStringResponse(201, ""), nil
+	})
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{Amount: "100", AgeLimit: 18})
+	assert.Equal(t, ErrPayerRestrictionsVersion, err)
+	assert.False(t, sent)
+}
+
+func TestNewInstructionUUID(t *testing.T) {
+	first, err := NewInstructionUUID()
+	assert.Nil(t, err)
+
+	second, err := NewInstructionUUID()
+	assert.Nil(t, err)
+
+	assert.True(t, instructionUUID.MatchString(first))
+	assert.Equal(t, strings.ToUpper(first), first)
+	assert.NotEqual(t, first, second)
+}
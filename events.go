@@ -0,0 +1,163 @@
+package swish
+
+import (
+	"context"
+	"time"
+)
+
+// Types of events for payment requests and refunds.
+const (
+	EventCreated   = "created"
+	EventPaid      = "paid"
+	EventDeclined  = "declined"
+	EventCancelled = "cancelled"
+	EventRefunded  = "refunded"
+)
+
+// Event represents a state change of a payment request or refund.
+type Event struct {
+	Type        string          `json:"type"`
+	PaymentType string          `json:"paymentType"`
+	Request     *PaymentRequest `json:"request"`
+	Time        time.Time       `json:"time"`
+
+	// CorrelationID and Tenant are taken from the context the event is published with.
+	CorrelationID string `json:"correlationId,omitempty"`
+	Tenant        string `json:"tenant,omitempty"`
+}
+
+// EventPublisher represents a destination for events.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// EventPublisherFunc is a function that implements EventPublisher.
+type EventPublisherFunc func(context.Context, *Event) error
+
+// Publish publishes the event with the function.
+func (f EventPublisherFunc) Publish(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+// newEvent returns the event for the given payment request or refund status, or nil if
+// the status has no event.
+func newEvent(typ string, req *PaymentRequest) *Event {
+	var eventType string
+
+	switch {
+	case req.Status == StatusCreated:
+		eventType = EventCreated
+	case typ == TypeRefund && req.Status == StatusPaid:
+		eventType = EventRefunded
+	case typ == TypeRefund:
+		return nil
+	case req.Status == StatusPaid:
+		eventType = EventPaid
+	case req.Status == StatusDeclined:
+		eventType = EventDeclined
+	case req.Status == StatusCancelled:
+		eventType = EventCancelled
+	default:
+		return nil
+	}
+
+	r := *req
+
+	return &Event{
+		Type:        eventType,
+		PaymentType: typ,
+		Request:     &r,
+		Time:        time.Now(),
+	}
+}
+
+// saveAndPublish saves the given payment request or refund in the store and publishes its
+// event, if any. When the store is a SQL store and the event publisher is a SQL outbox in the
+// same database, both are written in one transaction, so the event is stored only with the
+// request. Failures are logged since the request has already been sent to Swish.
+func (c *Client) saveAndPublish(ctx context.Context, typ string, req *PaymentRequest) {
+	if req == nil {
+		return
+	}
+
+	if store, outbox, ok := sqlOutbox(c.Store, c.Events); ok {
+		if err := saveAndPublishTx(ctx, store, outbox, contextEvent(ctx, typ, req), typ, req); err != nil {
+			logf(ctx, "failed to save and publish %s %s: %s", typ, req.ID, err)
+		}
+
+		return
+	}
+
+	c.save(ctx, typ, req)
+	c.publish(ctx, typ, req)
+}
+
+// sqlOutbox returns the given store and event publisher as a SQL store and a SQL outbox if
+// they are in the same database, so they can be written in one transaction.
+func sqlOutbox(s Store, events EventPublisher) (*SQLStore, *SQLOutbox, bool) {
+	store, ok := s.(*SQLStore)
+	if !ok {
+		return nil, nil, false
+	}
+
+	outbox, ok := events.(*SQLOutbox)
+	if !ok || store.db != outbox.db {
+		return nil, nil, false
+	}
+
+	return store, outbox, true
+}
+
+// saveAndPublishTx saves the given payment request or refund in the SQL store and the event,
+// if any, in the SQL outbox in one transaction.
+func saveAndPublishTx(ctx context.Context, store *SQLStore, outbox *SQLOutbox, event *Event, typ string, req *PaymentRequest) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := store.SaveTx(ctx, tx, typ, req); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if event != nil {
+		if err := outbox.PublishTx(ctx, tx, event); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// publish publishes the event for the given payment request or refund, if any. Failures
+// are logged since the request has already been sent to Swish.
+func (c *Client) publish(ctx context.Context, typ string, req *PaymentRequest) {
+	if c.Events == nil || req == nil {
+		return
+	}
+
+	event := contextEvent(ctx, typ, req)
+	if event == nil {
+		return
+	}
+
+	if err := c.Events.Publish(ctx, event); err != nil {
+		logf(ctx, "failed to publish %s event for %s: %s", event.Type, req.ID, err)
+	}
+}
+
+// contextEvent returns the event for the given payment request or refund with the metadata in
+// the given context, or nil if the status has no event.
+func contextEvent(ctx context.Context, typ string, req *PaymentRequest) *Event {
+	event := newEvent(typ, req)
+	if event == nil {
+		return nil
+	}
+
+	event.CorrelationID = CorrelationID(ctx)
+	event.Tenant = Tenant(ctx)
+
+	return event
+}
@@ -0,0 +1,123 @@
+package swish
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SQLOutbox represents a transactional outbox that stores events in a SQL database using
+// SQLite syntax. Events are stored with Publish or, in the same transaction as the
+// application's own changes, with PublishTx and delivered to downstream services with Relay.
+// A client with a SQL store in the same database stores the events in the same transaction
+// as the payment requests and refunds.
+type SQLOutbox struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLOutbox creates a new SQL outbox that uses the given table, swish_outbox when empty.
+// The table is created with CreateTable.
+func NewSQLOutbox(db *sql.DB, table string) *SQLOutbox {
+	if table == "" {
+		table = "swish_outbox"
+	}
+
+	return &SQLOutbox{
+		db:    db,
+		table: table,
+	}
+}
+
+// CreateTable creates the outbox's table if it does not exist.
+func (o *SQLOutbox) CreateTable(ctx context.Context) error {
+	_, err := o.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		data TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		published_at INTEGER
+	)`, o.table))
+
+	return err
+}
+
+// Publish stores the event in the outbox.
+func (o *SQLOutbox) Publish(ctx context.Context, event *Event) error {
+	return o.insert(ctx, o.db, event)
+}
+
+// PublishTx stores the event in the outbox within the given transaction.
+func (o *SQLOutbox) PublishTx(ctx context.Context, tx *sql.Tx, event *Event) error {
+	return o.insert(ctx, tx, event)
+}
+
+// Relay publishes up to limit unpublished events in order to the given publisher and marks
+// them as published. It stops at the first event that fails, so the event and the ones after
+// it are published again on the next relay. It returns the number of published events.
+func (o *SQLOutbox) Relay(ctx context.Context, publisher EventPublisher, limit int) (int, error) {
+	rows, err := o.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, data FROM %s
+		WHERE published_at IS NULL ORDER BY id LIMIT ?`, o.table), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type outboxEvent struct {
+		id    int64
+		event *Event
+	}
+
+	var events []outboxEvent
+
+	for rows.Next() {
+		var e outboxEvent
+		var data string
+
+		if err := rows.Scan(&e.id, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		if err := json.Unmarshal([]byte(data), &e.event); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		events = append(events, e)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, e := range events {
+		if err := publisher.Publish(ctx, e.event); err != nil {
+			return i, err
+		}
+
+		if _, err := o.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET published_at = ? WHERE id = ?`, o.table), time.Now().UnixNano(), e.id); err != nil {
+			return i, err
+		}
+	}
+
+	return len(events), nil
+}
+
+// insert stores the event with the given executor.
+func (o *SQLOutbox) insert(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (type, data, created_at) VALUES (?, ?, ?)`, o.table),
+		event.Type, string(data), time.Now().UnixNano())
+
+	return err
+}
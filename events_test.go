@@ -0,0 +1,280 @@
+package swish
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestEvents(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	var events []*Event
+
+	publisher := EventPublisherFunc(func(ctx context.Context, event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Events:     publisher,
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	})
+
+	httpmock.RegisterResponder("PATCH", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, `{"id":"AB23D7406ECE4542A80152D909EF9F6B","status":"CANCELLED"}`), nil
+	})
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{Amount: "100"})
+	assert.Nil(t, err)
+
+	_, err = client.CancelPaymentRequest(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+
+	handler := &CallbackHandler{Events: publisher}
+
+	for _, body := range []string{
+		`{"id":"1","status":"PAID"}`,
+		`{"id":"2","status":"DECLINED"}`,
+		`{"id":"3","status":"PAID","originalPaymentReference":"ref"}`,
+		`{"id":"4","status":"DEBITED","originalPaymentReference":"ref"}`,
+	} {
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/callback", strings.NewReader(body)))
+
+		assert.Equal(t, 200, rec.Code)
+	}
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	assert.Equal(t, []string{EventCreated, EventCancelled, EventPaid, EventDeclined, EventRefunded}, types)
+	assert.Equal(t, TypeRefund, events[4].PaymentType)
+
+	// A failing publisher does not fail the callback, so the hooks are not called again.
+	paid := 0
+
+	handler.Events = EventPublisherFunc(func(ctx context.Context, event *Event) error {
+		return errors.New("failed")
+	})
+	handler.OnPaid = func(ctx context.Context, cb *Callback) error {
+		paid++
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/callback", strings.NewReader(`{"id":"5","status":"PAID"}`)))
+		assert.Equal(t, 200, rec.Code)
+	}
+
+	assert.Equal(t, 1, paid)
+}
+
+func TestSQLOutbox(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+
+	defer db.Close()
+
+	ctx := context.Background()
+
+	outbox := NewSQLOutbox(db, "")
+	assert.Nil(t, outbox.CreateTable(ctx))
+
+	assert.Nil(t, outbox.Publish(ctx, newEvent(TypePaymentRequest, &PaymentRequest{ID: "1", Status: StatusCreated})))
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, outbox.PublishTx(ctx, tx, newEvent(TypePaymentRequest, &PaymentRequest{ID: "1", Status: StatusPaid})))
+	assert.Nil(t, tx.Commit())
+
+	tx, err = db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, outbox.PublishTx(ctx, tx, newEvent(TypePaymentRequest, &PaymentRequest{ID: "2", Status: StatusPaid})))
+	assert.Nil(t, tx.Rollback())
+
+	var relayed []*Event
+
+	failing := EventPublisherFunc(func(ctx context.Context, event *Event) error {
+		if event.Type == EventPaid {
+			return errors.New("failed")
+		}
+
+		relayed = append(relayed, event)
+		return nil
+	})
+
+	n, err := outbox.Relay(ctx, failing, 10)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = outbox.Relay(ctx, EventPublisherFunc(func(ctx context.Context, event *Event) error {
+		relayed = append(relayed, event)
+		return nil
+	}), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, 2, len(relayed))
+	assert.Equal(t, EventCreated, relayed[0].Type)
+	assert.Equal(t, EventPaid, relayed[1].Type)
+	assert.Equal(t, "1", relayed[1].Request.ID)
+
+	n, err = outbox.Relay(ctx, failing, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestSQLStoreAndOutboxTransaction(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+
+	defer db.Close()
+
+	// Every connection to :memory: is a new database.
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+
+	store := NewSQLStore(db, "")
+	assert.Nil(t, store.CreateTable(ctx))
+
+	outbox := NewSQLOutbox(db, "")
+	assert.Nil(t, outbox.CreateTable(ctx))
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Store:      store,
+		Events:     outbox,
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		var r *PaymentRequest
+		json.NewDecoder(req.Body).Decode(&r)
+
+		resp := httpmock.NewStringResponse(201, "")
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/"+r.PayeePaymentReference)
+
+		return resp, nil
+	})
+
+	_, err = client.CreatePaymentRequest(ctx, &PaymentRequest{PayeePaymentReference: "1", Amount: "100"})
+	assert.Nil(t, err)
+
+	_, err = store.Get(ctx, "1")
+	assert.Nil(t, err)
+
+	var events int
+	assert.Nil(t, db.QueryRow(`SELECT COUNT(*) FROM swish_outbox`).Scan(&events))
+	assert.Equal(t, 1, events)
+
+	// The payment request is not saved when its event can not be stored.
+	_, err = db.Exec(`DROP TABLE swish_outbox`)
+	assert.Nil(t, err)
+
+	_, err = client.CreatePaymentRequest(ctx, &PaymentRequest{PayeePaymentReference: "2", Amount: "100"})
+	assert.Nil(t, err)
+
+	_, err = store.Get(ctx, "2")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestCallbackHandlerSQLOutbox(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+
+	defer db.Close()
+
+	// Every connection to :memory: is a new database.
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+
+	store := NewSQLStore(db, "")
+	assert.Nil(t, store.CreateTable(ctx))
+
+	outbox := NewSQLOutbox(db, "")
+	assert.Nil(t, outbox.CreateTable(ctx))
+
+	paid := 0
+
+	handler := &CallbackHandler{
+		Store:  store,
+		Events: outbox,
+		OnPaid: func(ctx context.Context, cb *Callback) error {
+			paid++
+			return nil
+		},
+	}
+
+	deliver := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/callback", strings.NewReader(`{"id":"1","status":"PAID"}`)))
+
+		return rec.Code
+	}
+
+	// A callback whose event can not be stored fails before the hooks, so it is delivered again.
+	_, err = db.Exec(`DROP TABLE swish_outbox`)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 500, deliver())
+	assert.Equal(t, 0, paid)
+
+	_, err = store.Get(ctx, "1")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, outbox.CreateTable(ctx))
+
+	assert.Equal(t, 200, deliver())
+	assert.Equal(t, 1, paid)
+
+	record, err := store.Get(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPaid, record.Request.Status)
+
+	var events []*Event
+
+	n, err := outbox.Relay(ctx, EventPublisherFunc(func(ctx context.Context, event *Event) error {
+		events = append(events, event)
+		return nil
+	}), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, EventPaid, events[0].Type)
+}
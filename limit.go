@@ -0,0 +1,239 @@
+package swish
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit represents a rate limit and a cap on concurrent requests to an endpoint of Swish API.
+type Limit struct {
+	// Rate is the number of requests per second, no limit when zero.
+	Rate float64
+	// Burst is the number of requests that can be sent at once before the rate applies, 1 when zero.
+	Burst int
+	// MaxInFlight is the maximum number of requests waiting for a response, no limit when zero.
+	MaxInFlight int
+}
+
+// LimitStats represents the waiting of requests to an endpoint with a limit.
+type LimitStats struct {
+	// Requests is the number of requests that passed the limit.
+	Requests int64
+	// Waited is the number of requests that had to wait.
+	Waited int64
+	// WaitTime is the total time requests have waited.
+	WaitTime time.Duration
+	// MaxWaitTime is the longest time a request has waited.
+	MaxWaitTime time.Duration
+}
+
+// limiter represents a token bucket and a semaphore for an endpoint.
+type limiter struct {
+	limit Limit
+	sem   chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	stats  LimitStats
+}
+
+// newLimiter creates a new limiter with a full token bucket.
+func newLimiter(limit Limit) *limiter {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+
+	l := &limiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+
+	if limit.MaxInFlight > 0 {
+		l.sem = make(chan struct{}, limit.MaxInFlight)
+	}
+
+	return l
+}
+
+// wait waits until a request can be sent or the context is done and returns how long the
+// request waited. The returned function must be called when the response is received to
+// let other requests in.
+func (l *limiter) wait(ctx context.Context) (func(), time.Duration, error) {
+	start := time.Now()
+	blocked := false
+
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			blocked = true
+
+			select {
+			case l.sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
+		}
+	}
+
+	release := func() {
+		if l.sem != nil {
+			<-l.sem
+		}
+	}
+
+	if delay := l.reserve(); delay > 0 {
+		blocked = true
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.cancel()
+			release()
+
+			return nil, 0, ctx.Err()
+		}
+	}
+
+	var waited time.Duration
+	if blocked {
+		waited = time.Since(start)
+	}
+
+	l.mu.Lock()
+	l.stats.Requests++
+	if blocked {
+		l.record(waited)
+	}
+	l.mu.Unlock()
+
+	return release, waited, nil
+}
+
+// record records a request that had to wait, must be called with the lock held.
+func (l *limiter) record(waited time.Duration) {
+	l.stats.Waited++
+	l.stats.WaitTime += waited
+
+	if waited > l.stats.MaxWaitTime {
+		l.stats.MaxWaitTime = waited
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait until it is available.
+func (l *limiter) reserve() time.Duration {
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+	if l.tokens > float64(l.limit.Burst) {
+		l.tokens = float64(l.limit.Burst)
+	}
+
+	l.last = now
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.limit.Rate * float64(time.Second))
+}
+
+// cancel puts back a token taken by a request that stopped waiting.
+func (l *limiter) cancel() {
+	if l.limit.Rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// newLimiters creates the limiters for the given limits.
+func newLimiters(limits map[string]*Limit) map[string]*limiter {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	limiters := make(map[string]*limiter, len(limits))
+	for endpoint, limit := range limits {
+		if limit != nil {
+			limiters[endpoint] = newLimiter(*limit)
+		}
+	}
+
+	return limiters
+}
+
+// limitEndpoint returns the endpoint that limits apply to, the first segment of the given
+// endpoint, like /paymentrequests for /paymentrequests/{id}.
+func limitEndpoint(endpoint string) string {
+	if len(endpoint) < 2 {
+		return endpoint
+	}
+
+	if i := strings.Index(endpoint[1:], "/"); i >= 0 {
+		return endpoint[:i+1]
+	}
+
+	return endpoint
+}
+
+// limiter returns the limiter for the given endpoint, or the default limiter, if any.
+func (s *Client) limiter(endpoint string) (string, *limiter) {
+	endpoint = limitEndpoint(endpoint)
+
+	if l, ok := s.limiters[endpoint]; ok {
+		return endpoint, l
+	}
+
+	return "", s.limiters[""]
+}
+
+// waitLimit waits until a request to the given endpoint can be sent. The returned function
+// must be called when the response is received.
+func (s *Client) waitLimit(ctx context.Context, endpoint string) (func(), error) {
+	name, l := s.limiter(endpoint)
+	if l == nil {
+		return func() {}, nil
+	}
+
+	release, waited, err := l.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.OnLimitWait != nil && waited > 0 {
+		s.OnLimitWait(name, waited)
+	}
+
+	return release, nil
+}
+
+// LimitStats returns the stats of the limit for the given endpoint, like /paymentrequests,
+// or of the default limit for an empty endpoint.
+func (s *Client) LimitStats(endpoint string) LimitStats {
+	l, ok := s.limiters[endpoint]
+	if !ok {
+		return LimitStats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stats
+}
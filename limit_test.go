@@ -0,0 +1,112 @@
+package swish
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestLimitEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{"/paymentrequests", "/paymentrequests"},
+		{"/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", "/paymentrequests"},
+		{"/refunds/ABC", "/refunds"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, limitEndpoint(test.endpoint), test.endpoint)
+	}
+}
+
+func TestClientLimits(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	var waits []time.Duration
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Limits: map[string]*Limit{
+			"/paymentrequests": {Rate: 20, Burst: 1},
+		},
+		OnLimitWait: func(endpoint string, wait time.Duration) {
+			assert.Equal(t, "/paymentrequests", endpoint)
+			waits = append(waits, wait)
+		},
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B",
+		httpmock.NewStringResponder(200, `{"id":"AB23D7406ECE4542A80152D909EF9F6B"}`))
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds/ABC",
+		httpmock.NewStringResponder(200, `{"id":"ABC"}`))
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.PaymentRequest(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+		assert.Nil(t, err)
+
+		_, err = client.RefundRequest(context.Background(), "ABC")
+		assert.Nil(t, err)
+	}
+
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+	assert.Equal(t, 2, len(waits))
+
+	stats := client.LimitStats("/paymentrequests")
+	assert.Equal(t, int64(3), stats.Requests)
+	assert.Equal(t, int64(2), stats.Waited)
+	assert.True(t, stats.WaitTime >= 90*time.Millisecond)
+	assert.True(t, stats.MaxWaitTime > 0)
+
+	assert.Equal(t, LimitStats{}, client.LimitStats("/refunds"))
+}
+
+func TestLimiterWait(t *testing.T) {
+	l := newLimiter(Limit{MaxInFlight: 1})
+
+	release, waited, err := l.wait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), waited)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err = l.wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+
+	release, waited, err = l.wait(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, waited > 0)
+	release()
+
+	l = newLimiter(Limit{Rate: 1})
+
+	_, _, err = l.wait(context.Background())
+	assert.Nil(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err = l.wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, l.tokens > -0.1)
+}
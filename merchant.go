@@ -0,0 +1,96 @@
+package swish
+
+import (
+	"context"
+	"strings"
+	"text/template"
+)
+
+// Merchant represents the merchant profile with default values for payment requests and refunds.
+type Merchant struct {
+	// PayeeAlias is the merchant's Swish number, used as payee alias for payment
+	// requests and as payer alias for refunds.
+	PayeeAlias string
+	// Currency is the currency, like SEK.
+	Currency string
+	// CallbackURL is the callback URL, or the base URL when CallbackKey is set.
+	CallbackURL string
+	// CallbackKey is the key used to build callback URLs with BuildCallbackURL, routed by
+	// the payee payment reference of payment requests or payer payment reference of refunds.
+	CallbackKey []byte
+	// Tenant is the tenant in callback URLs built with CallbackKey.
+	Tenant string
+	// Message is a text/template for the message, executed with the payment request or refund,
+	// for example "Order {{.PayeePaymentReference}}".
+	Message string
+}
+
+// parseMessageTemplate parses the merchant's message template, if any.
+func parseMessageTemplate(m *Merchant) (*template.Template, error) {
+	if m == nil || m.Message == "" {
+		return nil, nil
+	}
+
+	return template.New("message").Parse(m.Message)
+}
+
+// applyMerchant fills the empty fields of the given payment request with the merchant's
+// defaults. The payee alias is used as payer alias for refunds.
+func (c *Client) applyMerchant(ctx context.Context, typ string, req *PaymentRequest) error {
+	if c.Merchant == nil {
+		return nil
+	}
+
+	alias := &req.PayeeAlias
+	if typ == TypeRefund {
+		alias = &req.PayerAlias
+	}
+
+	if *alias == "" {
+		*alias = c.Merchant.PayeeAlias
+	}
+
+	if req.Currency == "" {
+		req.Currency = c.Merchant.Currency
+	}
+
+	if req.CallbackURL == "" && c.Merchant.CallbackURL != "" {
+		if c.Merchant.CallbackKey == nil {
+			req.CallbackURL = c.Merchant.CallbackURL
+		} else {
+			route := &CallbackRoute{
+				Type:          typ,
+				Tenant:        c.Merchant.Tenant,
+				Reference:     req.PayeePaymentReference,
+				CorrelationID: CorrelationID(ctx),
+			}
+
+			if route.Tenant == "" {
+				route.Tenant = Tenant(ctx)
+			}
+
+			if typ == TypeRefund {
+				route.Reference = req.PayerPaymentReference
+			}
+
+			callbackURL, err := BuildCallbackURL(c.Merchant.CallbackURL, c.Merchant.CallbackKey, route)
+			if err != nil {
+				return err
+			}
+
+			req.CallbackURL = callbackURL
+		}
+	}
+
+	if req.Message == "" && c.messageTemplate != nil {
+		var message strings.Builder
+
+		if err := c.messageTemplate.Execute(&message, req); err != nil {
+			return err
+		}
+
+		req.Message = message.String()
+	}
+
+	return nil
+}
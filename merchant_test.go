@@ -0,0 +1,114 @@
+package swish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestMerchant(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Merchant: &Merchant{
+			PayeeAlias:  "1231181189",
+			Currency:    "SEK",
+			CallbackURL: "https://example.com/api/swishcb",
+			Message:     "Order {{.PayeePaymentReference}}",
+		},
+	})
+	assert.Nil(t, err)
+
+	var sent []*PaymentRequest
+
+	responder := func(req *http.Request) (*http.Response, error) {
+		var pr *PaymentRequest
+		json.NewDecoder(req.Body).Decode(&pr)
+		sent = append(sent, pr)
+
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", req.URL.String()+"/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	}
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", responder)
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds", responder)
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		PayeePaymentReference: "0123456789",
+		Amount:                "100",
+	})
+	assert.Nil(t, err)
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		PayeeAlias: "1234760039",
+		Currency:   "EUR",
+		Message:    "Kingston USB Flash Drive 8 GB",
+		Amount:     "100",
+	})
+	assert.Nil(t, err)
+
+	_, err = client.CreateRefundRequest(context.Background(), &PaymentRequest{
+		OriginalPaymentReference: "6D6CD7406ECE4542A80152D909EF9F6B",
+		PayerPaymentReference:    "0123456789",
+		Amount:                   "100",
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, len(sent))
+
+	assert.Equal(t, &PaymentRequest{
+		PayeePaymentReference: "0123456789",
+		PayeeAlias:            "1231181189",
+		Amount:                "100",
+		Currency:              "SEK",
+		CallbackURL:           "https://example.com/api/swishcb",
+		Message:               "Order 0123456789",
+	}, sent[0])
+
+	assert.Equal(t, "1234760039", sent[1].PayeeAlias)
+	assert.Equal(t, "EUR", sent[1].Currency)
+	assert.Equal(t, "Kingston USB Flash Drive 8 GB", sent[1].Message)
+
+	assert.Equal(t, "1231181189", sent[2].PayerAlias)
+	assert.Equal(t, "", sent[2].PayeeAlias)
+	assert.Equal(t, "Order ", sent[2].Message)
+
+	client.Merchant.CallbackKey = []byte("secret")
+	client.Merchant.Tenant = "shop"
+
+	_, err = client.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		PayeePaymentReference: "0123456789",
+		Amount:                "100",
+	})
+	assert.Nil(t, err)
+
+	u, err := url.Parse(sent[3].CallbackURL)
+	assert.Nil(t, err)
+
+	route, err := ParseCallbackURL(u, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, &CallbackRoute{Type: TypePaymentRequest, Tenant: "shop", Reference: "0123456789"}, route)
+
+	_, err = NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Merchant:   &Merchant{Message: "{{"},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,103 @@
+package swish
+
+import (
+	"context"
+	"log"
+	"net/http"
+)
+
+// CorrelationIDHeader is the header the correlation ID is sent in to Swish API.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// metadataKey is the context key for request metadata.
+type metadataKey struct{}
+
+// metadata represents the request metadata in a context.
+type metadata struct {
+	correlationID string
+	tenant        string
+	header        http.Header
+}
+
+// fromContext returns a copy of the metadata in the given context.
+func fromContext(ctx context.Context) metadata {
+	m, _ := ctx.Value(metadataKey{}).(metadata)
+
+	if m.header != nil {
+		m.header = m.header.Clone()
+	}
+
+	return m
+}
+
+// WithCorrelationID returns a context with the given correlation ID. The correlation ID is sent
+// to Swish API, written to audit records and events and included in callback URLs built from
+// the merchant profile, so the callback's context has it too.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	m := fromContext(ctx)
+	m.correlationID = id
+
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// CorrelationID returns the correlation ID in the given context, if any.
+func CorrelationID(ctx context.Context) string {
+	return fromContext(ctx).correlationID
+}
+
+// WithTenant returns a context with the given tenant. The tenant is written to audit records
+// and events and used in callback URLs built from a merchant profile without a tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	m := fromContext(ctx)
+	m.tenant = tenant
+
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// Tenant returns the tenant in the given context, if any.
+func Tenant(ctx context.Context) string {
+	return fromContext(ctx).tenant
+}
+
+// WithHeader returns a context with the given header added to the headers that are sent to Swish API.
+func WithHeader(ctx context.Context, name, value string) context.Context {
+	m := fromContext(ctx)
+
+	if m.header == nil {
+		m.header = http.Header{}
+	}
+
+	m.header.Add(name, value)
+
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// Headers returns the headers in the given context, if any.
+func Headers(ctx context.Context) http.Header {
+	return fromContext(ctx).header
+}
+
+// setMetadataHeaders sets the headers and correlation ID in the given context on the request.
+func setMetadataHeaders(ctx context.Context, req *http.Request) {
+	m := fromContext(ctx)
+
+	for name, values := range m.header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	if m.correlationID != "" {
+		req.Header.Set(CorrelationIDHeader, m.correlationID)
+	}
+}
+
+// logf logs the given message with the correlation ID in the given context, if any.
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id := CorrelationID(ctx); id != "" {
+		log.Printf("swish: [%s] "+format, append([]interface{}{id}, args...)...)
+		return
+	}
+
+	log.Printf("swish: "+format, args...)
+}
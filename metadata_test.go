@@ -0,0 +1,125 @@
+package swish
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestContextMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Equal(t, "", CorrelationID(ctx))
+	assert.Equal(t, "", Tenant(ctx))
+	assert.Nil(t, Headers(ctx))
+
+	ctx = WithCorrelationID(ctx, "checkout-1")
+	ctx = WithTenant(ctx, "shop")
+	first := WithHeader(ctx, "X-Shop", "a")
+	second := WithHeader(first, "X-Shop", "b")
+
+	assert.Equal(t, "checkout-1", CorrelationID(second))
+	assert.Equal(t, "shop", Tenant(second))
+	assert.Equal(t, []string{"a"}, Headers(first)["X-Shop"])
+	assert.Equal(t, []string{"a", "b"}, Headers(second)["X-Shop"])
+}
+
+func TestRequestMetadata(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	var records []*AuditRecord
+	var events []*Event
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Merchant: &Merchant{
+			PayeeAlias:  "1231181189",
+			CallbackURL: "https://example.com/callback",
+			CallbackKey: []byte("secret"),
+		},
+		Audit: auditSinkFunc(func(ctx context.Context, record *AuditRecord) error {
+			records = append(records, record)
+			return nil
+		}),
+		Events: EventPublisherFunc(func(ctx context.Context, event *Event) error {
+			events = append(events, event)
+			return nil
+		}),
+	})
+	assert.Nil(t, err)
+
+	var header http.Header
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+
+		resp := httpmock.NewStringResponse(201, "")
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	})
+
+	ctx := WithHeader(WithTenant(WithCorrelationID(context.Background(), "checkout-1"), "shop"), "X-Shop", "a")
+
+	req, err := client.CreatePaymentRequest(ctx, &PaymentRequest{
+		PayeePaymentReference: "order-1",
+		Amount:                "100",
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "checkout-1", header.Get(CorrelationIDHeader))
+	assert.Equal(t, "a", header.Get("X-Shop"))
+
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "checkout-1", records[0].CorrelationID)
+	assert.Equal(t, "shop", records[0].Tenant)
+
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "checkout-1", events[0].CorrelationID)
+	assert.Equal(t, "shop", events[0].Tenant)
+
+	u, err := url.Parse(req.CallbackURL)
+	assert.Nil(t, err)
+
+	route, err := ParseCallbackURL(u, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, &CallbackRoute{Type: TypePaymentRequest, Tenant: "shop", Reference: "order-1", CorrelationID: "checkout-1"}, route)
+
+	var correlationID, tenant string
+
+	handler := &CallbackHandler{
+		CallbackKey: []byte("secret"),
+		OnCallback: func(ctx context.Context, cb *Callback) error {
+			correlationID = CorrelationID(ctx)
+			tenant = Tenant(ctx)
+			return nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", req.CallbackURL, strings.NewReader(`{"id":"AB23D7406ECE4542A80152D909EF9F6B","payeePaymentReference":"order-1","status":"PAID"}`)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "checkout-1", correlationID)
+	assert.Equal(t, "shop", tenant)
+}
+
+// auditSinkFunc is a function that implements AuditSink.
+type auditSinkFunc func(context.Context, *AuditRecord) error
+
+// Audit writes the record with the function.
+func (f auditSinkFunc) Audit(ctx context.Context, record *AuditRecord) error {
+	return f(ctx, record)
+}
@@ -0,0 +1,70 @@
+package swish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestQRCodeImage(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	var body map[string]interface{}
+
+	httpmock.RegisterResponder("POST", QRCodeURL, func(req *http.Request) (*http.Response, error) {
+		json.NewDecoder(req.Body).Decode(&body)
+
+		if body["token"] == "invalid" {
+			return httpmock.NewStringResponse(400, ""), nil
+		}
+
+		return httpmock.NewStringResponse(200, "image"), nil
+	})
+
+	tests := []struct {
+		description    string
+		token          string
+		opts           *QRCode
+		expectedBody   map[string]interface{}
+		expectedResult []byte
+		expectedError  error
+	}{
+		{
+			description:    "png by default",
+			token:          "c28a4061470f4af48973bd2a4642b4fa",
+			expectedBody:   map[string]interface{}{"token": "c28a4061470f4af48973bd2a4642b4fa", "format": "png"},
+			expectedResult: []byte("image"),
+		},
+		{
+			description:    "svg with border",
+			token:          "c28a4061470f4af48973bd2a4642b4fa",
+			opts:           &QRCode{Format: "svg", Border: 2},
+			expectedBody:   map[string]interface{}{"token": "c28a4061470f4af48973bd2a4642b4fa", "format": "svg", "border": float64(2)},
+			expectedResult: []byte("image"),
+		},
+		{
+			description:   "bad status code",
+			token:         "invalid",
+			expectedBody:  map[string]interface{}{"token": "invalid", "format": "png"},
+			expectedError: errors.New("Bad status code from Swish QR code generator: 400"),
+		},
+	}
+
+	for _, test := range tests {
+		body = nil
+
+		image, err := QRCodeImage(context.Background(), test.token, test.opts)
+
+		assert.Equal(t, test.expectedError, err, test.description)
+		assert.Equal(t, test.expectedResult, image, test.description)
+		assert.Equal(t, test.expectedBody, body, test.description)
+	}
+}
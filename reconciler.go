@@ -0,0 +1,104 @@
+package swish
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Reconciler represents a reconciler that fetches the status of payment requests and refunds
+// that have not reached a final status, for when callbacks from Swish never arrive.
+type Reconciler struct {
+	Client *Client
+	Store  Store
+	// Handler is used to dispatch status changes through the same hooks as callbacks.
+	Handler *CallbackHandler
+	// MinAge is how old payment requests and refunds must be before they are reconciled.
+	MinAge time.Duration
+}
+
+// Reconcile fetches the status of the pending payment requests and refunds in the store that
+// are older than the minimum age and dispatches the ones that have changed. It returns the
+// number of dispatched changes. A failing payment request or refund does not stop the others
+// from being reconciled, the first error is returned when all are done.
+func (r *Reconciler) Reconcile(ctx context.Context) (int, error) {
+	pending, err := r.Store.Pending(ctx, time.Now().Add(-r.MinAge))
+	if err != nil {
+		return 0, err
+	}
+
+	var changed int
+	var firstErr error
+
+	for _, record := range pending {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+
+		ok, err := r.reconcile(ctx, record)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if ok {
+			changed++
+		}
+	}
+
+	return changed, firstErr
+}
+
+// reconcile fetches the status of the given record and dispatches it if it has changed.
+func (r *Reconciler) reconcile(ctx context.Context, record *StoreRecord) (bool, error) {
+	var req *PaymentRequest
+	var err error
+
+	if record.Type == TypeRefund {
+		req, err = r.Client.refundRequest(ctx, record.Request.ID)
+	} else {
+		req, err = r.Client.paymentRequest(ctx, record.Request.ID)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if req == nil || req.Status == record.Request.Status {
+		return false, nil
+	}
+
+	if r.Handler != nil {
+		if err := r.Handler.Dispatch(ctx, &Callback{Type: record.Type, PaymentRequest: req}); err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.Store.Save(ctx, record.Type, req); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Run reconciles on the given interval until the context is done. Failures are logged.
+// The interval is a minute when zero or negative. It is meant to run in a goroutine.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("swish: failed to reconcile: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
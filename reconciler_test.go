@@ -0,0 +1,98 @@
+package swish
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestReconciler(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	store := NewMemoryStore()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+	assert.Nil(t, err)
+
+	for id, status := range map[string]string{
+		"paid":     `{"id":"paid","amount":"100","status":"PAID"}`,
+		"waiting":  `{"id":"waiting","amount":"100","status":"CREATED"}`,
+		"declined": `{"id":"declined","amount":"100","status":"DECLINED"}`,
+	} {
+		body := status
+		httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/"+id, func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewStringResponse(200, body), nil
+		})
+	}
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds/refund", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, `{"id":"refund","amount":"10","status":"PAID","originalPaymentReference":"ref"}`), nil
+	})
+
+	for _, id := range []string{"paid", "waiting", "declined"} {
+		assert.Nil(t, store.Save(context.Background(), TypePaymentRequest, &PaymentRequest{ID: id, Status: StatusCreated}))
+	}
+
+	assert.Nil(t, store.Save(context.Background(), TypeRefund, &PaymentRequest{ID: "refund", Status: StatusCreated}))
+
+	var paid, declined []*Callback
+
+	reconciler := &Reconciler{
+		Client: client,
+		Store:  store,
+		Handler: &CallbackHandler{
+			OnPaid: func(ctx context.Context, cb *Callback) error {
+				paid = append(paid, cb)
+				return nil
+			},
+			OnDeclined: func(ctx context.Context, cb *Callback) error {
+				declined = append(declined, cb)
+				return nil
+			},
+		},
+		MinAge: time.Hour,
+	}
+
+	// Nothing is old enough.
+	changed, err := reconciler.Reconcile(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, changed)
+
+	reconciler.MinAge = 0
+
+	changed, err = reconciler.Reconcile(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, changed)
+	assert.Equal(t, 2, len(paid))
+	assert.Equal(t, 1, len(declined))
+
+	pending, err := store.Pending(context.Background(), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, "waiting", pending[0].Request.ID)
+
+	changed, err = reconciler.Reconcile(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, changed)
+}
+
+func TestReconcilerRunDefaultInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A zero interval uses the default instead of panicking.
+	reconciler := &Reconciler{Store: NewMemoryStore()}
+	reconciler.Run(ctx, 0)
+}
@@ -0,0 +1,150 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPaymentNotPaid is the error when refunding a payment request that is not paid.
+	ErrPaymentNotPaid = errors.New("Error: Payment request is not paid")
+
+	// ErrRefundAmountExceeded is the error when a refund exceeds the amount that is left to refund.
+	ErrRefundAmountExceeded = errors.New("Error: Refund amount exceeds the refundable amount")
+
+	// ErrRefundWindowExpired is the error when refunding a payment request that was paid more than 13 months ago.
+	ErrRefundWindowExpired = errors.New("Error: Payment request was paid more than 13 months ago")
+
+	// ErrNoStore is the error when refunding a payment request with a client without a store.
+	ErrNoStore = errors.New("Error: A store is required to know earlier refunds")
+)
+
+// keyedMutex represents a set of mutexes, one for each key in use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock represents the mutex of a key and the number of callers that use it.
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock locks the mutex of the given key and returns the function that unlocks it.
+func (m *keyedMutex) Lock(key string) func() {
+	m.mu.Lock()
+
+	if m.locks == nil {
+		m.locks = make(map[string]*keyedLock)
+	}
+
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
+
+// RefundPayment will create a refund request for the payment request with the given id after
+// checking that the payment request is paid, was paid within the last 13 months and that the
+// refund together with earlier refunds does not exceed the paid amount.
+//
+// Earlier refunds are read from the client's store, so a store is required. Refunds of the same
+// payment by the client are created one at a time, so two refunds can not both pass the check.
+// The original payment reference, currency and payer alias of the refund are taken from the
+// payment request when empty, and the amount that is left to refund is used when the refund has
+// no amount.
+func (c *Client) RefundPayment(ctx context.Context, id string, refund *PaymentRequest) (*PaymentRequest, error) {
+	if c.Store == nil {
+		return nil, ErrNoStore
+	}
+
+	original, err := c.paidPaymentRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if original.Status != StatusPaid {
+		return nil, ErrPaymentNotPaid
+	}
+
+	datePaid, err := time.Parse(time.RFC3339, original.DatePaid)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(datePaid.AddDate(0, 13, 0)) {
+		return nil, ErrRefundWindowExpired
+	}
+
+	unlock := c.refunds.Lock(original.PaymentReference)
+	defer unlock()
+
+	refundable, err := refundableAmount(ctx, c.Store, original)
+	if err != nil {
+		return nil, err
+	}
+
+	r := *refund
+
+	if r.Amount == "" {
+		r.Amount = formatAmount(refundable)
+	}
+
+	amount, err := parseAmount(r.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount <= 0 || amount > refundable {
+		return nil, ErrRefundAmountExceeded
+	}
+
+	if r.OriginalPaymentReference == "" {
+		r.OriginalPaymentReference = original.PaymentReference
+	}
+
+	if r.Currency == "" {
+		r.Currency = original.Currency
+	}
+
+	if r.PayerAlias == "" {
+		r.PayerAlias = original.PayeeAlias
+	}
+
+	return c.CreateRefundRequest(ctx, &r)
+}
+
+// paidPaymentRequest returns the payment request with the given id from the store if
+// it is paid there, otherwise from Swish API.
+func (c *Client) paidPaymentRequest(ctx context.Context, id string) (*PaymentRequest, error) {
+	record, err := c.Store.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	if record != nil && record.Request.Status == StatusPaid {
+		return record.Request, nil
+	}
+
+	return c.PaymentRequest(ctx, id)
+}
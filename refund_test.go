@@ -0,0 +1,214 @@
+package swish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestRefundPayment(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	store := NewMemoryStore()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Store:      store,
+	})
+	assert.Nil(t, err)
+
+	var refunds []*PaymentRequest
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds", func(req *http.Request) (*http.Response, error) {
+		var refund *PaymentRequest
+		json.NewDecoder(req.Body).Decode(&refund)
+		refunds = append(refunds, refund)
+
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds/"+string(rune('A'+len(refunds))))
+
+		return resp, nil
+	})
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/created", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, `{"id":"created","amount":"100","status":"CREATED"}`), nil
+	})
+
+	now := time.Now().Format(time.RFC3339)
+	old := time.Now().AddDate(-1, -2, 0).Format(time.RFC3339)
+
+	for _, req := range []*PaymentRequest{
+		{ID: "paid", PaymentReference: "ref-paid", PayeeAlias: "1231181189", Amount: "100", Currency: "SEK", Status: StatusPaid, DatePaid: now},
+		{ID: "created", Status: StatusCreated},
+		{ID: "old", PaymentReference: "ref-old", Amount: "100", Status: StatusPaid, DatePaid: old},
+	} {
+		assert.Nil(t, store.Save(context.Background(), TypePaymentRequest, req))
+	}
+
+	tests := []struct {
+		description   string
+		id            string
+		amount        string
+		expectedError error
+	}{
+		{"partial refund", "paid", "60", nil},
+		{"refund exceeds refundable amount", "paid", "50", ErrRefundAmountExceeded},
+		{"refund rest", "paid", "", nil},
+		{"nothing left to refund", "paid", "", ErrRefundAmountExceeded},
+		{"not paid", "created", "10", ErrPaymentNotPaid},
+		{"refund window expired", "old", "10", ErrRefundWindowExpired},
+	}
+
+	for _, test := range tests {
+		_, err := client.RefundPayment(context.Background(), test.id, &PaymentRequest{
+			Amount:  test.amount,
+			Message: "Refund",
+		})
+
+		assert.Equal(t, test.expectedError, err, test.description)
+	}
+
+	assert.Equal(t, 2, len(refunds))
+	assert.Equal(t, "60", refunds[0].Amount)
+	assert.Equal(t, "40.00", refunds[1].Amount)
+	assert.Equal(t, "ref-paid", refunds[1].OriginalPaymentReference)
+	assert.Equal(t, "1231181189", refunds[1].PayerAlias)
+	assert.Equal(t, "SEK", refunds[1].Currency)
+}
+
+func TestRefundPaymentWithoutStore(t *testing.T) {
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+	assert.Nil(t, err)
+
+	_, err = client.RefundPayment(context.Background(), "paid", &PaymentRequest{Amount: "10"})
+	assert.Equal(t, ErrNoStore, err)
+}
+
+func TestRefundPaymentConcurrent(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	store := NewMemoryStore()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Store:      store,
+	})
+	assert.Nil(t, err)
+
+	var (
+		mu      sync.Mutex
+		created int
+	)
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds", func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		created++
+		id := fmt.Sprintf("refund-%d", created)
+		mu.Unlock()
+
+		// Give a concurrent refund time to pass the check if it is not serialized.
+		time.Sleep(10 * time.Millisecond)
+
+		resp := httpmock.NewStringResponse(201, "")
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds/"+id)
+
+		return resp, nil
+	})
+
+	assert.Nil(t, store.Save(context.Background(), TypePaymentRequest, &PaymentRequest{
+		ID:               "paid",
+		PaymentReference: "ref-paid",
+		Amount:           "100",
+		Status:           StatusPaid,
+		DatePaid:         time.Now().Format(time.RFC3339),
+	}))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := client.RefundPayment(context.Background(), "paid", &PaymentRequest{Amount: "60"})
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	exceeded := 0
+	for err := range errs {
+		if err == ErrRefundAmountExceeded {
+			exceeded++
+		}
+	}
+
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 3, exceeded)
+}
+
+// wrappingStore is a store that wraps ErrNotFound like stores on top of other databases.
+type wrappingStore struct {
+	*MemoryStore
+}
+
+// Get returns the record from the memory store with a wrapped ErrNotFound.
+func (s wrappingStore) Get(ctx context.Context, id string) (*StoreRecord, error) {
+	record, err := s.MemoryStore.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("store: %s: %w", id, err)
+	}
+
+	return record, nil
+}
+
+func TestRefundPaymentWrappedNotFound(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Store:      wrappingStore{NewMemoryStore()},
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/unknown", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, `{"id":"unknown","amount":"100","status":"CREATED"}`), nil
+	})
+
+	// A payment request that is not in the store is fetched from Swish API.
+	_, err = client.RefundPayment(context.Background(), "unknown", &PaymentRequest{Amount: "10"})
+	assert.Equal(t, ErrPaymentNotPaid, err)
+}
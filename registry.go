@@ -0,0 +1,135 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrNoPayeeAlias is the error when a request without alias can not be routed since more than one alias is registered.
+	ErrNoPayeeAlias = errors.New("Error: No payee alias in request and more than one Swish client registered")
+)
+
+// Registry represents a collection of Swish clients keyed by payee alias,
+// used when a single service handles multiple Swish numbers.
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+}
+
+// registryEntry represents a registered payee alias and its client once created.
+type registryEntry struct {
+	opts *Options
+
+	mu     sync.Mutex
+	client *Client
+}
+
+// NewRegistry creates a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: make(map[string]*registryEntry),
+	}
+}
+
+// Register adds the options for the given payee alias. The client and its
+// certificates are not loaded until the first request for the alias.
+func (r *Registry) Register(alias string, opts *Options) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[alias] = &registryEntry{opts: opts}
+}
+
+// Client returns the client for the given payee alias, creating it if needed. A client is
+// created without holding the registry's lock, so a slow or failing alias does not block
+// the other aliases.
+func (r *Registry) Client(alias string) (*Client, error) {
+	r.mu.Lock()
+	entry, ok := r.entries[alias]
+	r.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("No Swish client registered for payee alias: %s", alias)
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.client != nil {
+		return entry.client, nil
+	}
+
+	c, err := NewClient(entry.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.client = c
+
+	return c, nil
+}
+
+// route returns the client for the given alias. A request without alias, relying on the
+// merchant profile's payee alias, is routed to the only registered alias.
+func (r *Registry) route(alias string) (*Client, error) {
+	if alias == "" {
+		r.mu.Lock()
+		if len(r.entries) == 1 {
+			for a := range r.entries {
+				alias = a
+			}
+		}
+		r.mu.Unlock()
+
+		if alias == "" {
+			return nil, ErrNoPayeeAlias
+		}
+	}
+
+	return r.Client(alias)
+}
+
+// CreatePaymentRequest will create a payment request using the client registered for the request's payee alias,
+// or the only registered client when the request has no payee alias.
+func (r *Registry) CreatePaymentRequest(ctx context.Context, req *PaymentRequest) (*PaymentRequest, error) {
+	c, err := r.route(req.PayeeAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.CreatePaymentRequest(ctx, req)
+}
+
+// PaymentRequest will return a payment request for the given id using the client registered for the given payee alias.
+func (r *Registry) PaymentRequest(ctx context.Context, alias, id string) (*PaymentRequest, error) {
+	c, err := r.Client(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.PaymentRequest(ctx, id)
+}
+
+// CreateRefundRequest will create a refund request using the client registered for the request's payer alias,
+// since the merchant is the payer of a refund, or the only registered client when the request has no payer alias.
+func (r *Registry) CreateRefundRequest(ctx context.Context, req *PaymentRequest) (*PaymentRequest, error) {
+	c, err := r.route(req.PayerAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.CreateRefundRequest(ctx, req)
+}
+
+// RefundRequest will return a refund request for the given id using the client registered for the given payee alias.
+func (r *Registry) RefundRequest(ctx context.Context, alias, id string) (*PaymentRequest, error) {
+	c, err := r.Client(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.RefundRequest(ctx, id)
+}
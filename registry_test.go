@@ -0,0 +1,146 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestRegistry(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	registry := NewRegistry()
+
+	registry.Register("1231181189", &Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+
+	registry.Register("1234760039", &Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/missing.p12",
+		Root:       "./certs/root.pem",
+	})
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	})
+
+	res, err := registry.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		PayeeAlias: "1231181189",
+		Amount:     "100",
+		Currency:   "SEK",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "AB23D7406ECE4542A80152D909EF9F6B", res.ID)
+
+	first, err := registry.Client("1231181189")
+	assert.Nil(t, err)
+
+	second, err := registry.Client("1231181189")
+	assert.Nil(t, err)
+	assert.True(t, first == second)
+
+	// Certificates are loaded lazily so a broken alias only fails when used.
+	_, err = registry.CreatePaymentRequest(context.Background(), &PaymentRequest{
+		PayeeAlias: "1234760039",
+	})
+	assert.NotNil(t, err)
+
+	_, err = registry.CreateRefundRequest(context.Background(), &PaymentRequest{
+		PayerAlias: "1230000000",
+	})
+	assert.Equal(t, errors.New("No Swish client registered for payee alias: 1230000000"), err)
+}
+
+func TestRegistryMerchantAlias(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	})
+
+	registry := NewRegistry()
+
+	registry.Register("1231181189", &Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Merchant:   &Merchant{PayeeAlias: "1231181189"},
+	})
+
+	// The payee alias is filled from the merchant profile of the only registered client.
+	res, err := registry.CreatePaymentRequest(context.Background(), &PaymentRequest{Amount: "100"})
+	assert.Nil(t, err)
+	assert.Equal(t, "1231181189", res.PayeeAlias)
+
+	registry.Register("1234760039", &Options{Env: "test"})
+
+	_, err = registry.CreatePaymentRequest(context.Background(), &PaymentRequest{Amount: "100"})
+	assert.Equal(t, ErrNoPayeeAlias, err)
+}
+
+// blockingSecretProvider is a secret provider that blocks until it is released.
+type blockingSecretProvider chan struct{}
+
+// Secret waits until the provider is released and returns ErrSecretNotFound.
+func (p blockingSecretProvider) Secret(name string) ([]byte, error) {
+	<-p
+	return nil, ErrSecretNotFound
+}
+
+func TestRegistryClientDoesNotBlockOtherAliases(t *testing.T) {
+	registry := NewRegistry()
+
+	slow := make(blockingSecretProvider)
+	defer close(slow)
+
+	registry.Register("slow", &Options{Env: "test", Secrets: slow})
+	registry.Register("1231181189", &Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+	})
+
+	go registry.Client("slow")
+
+	// Let the slow alias start creating its client.
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := registry.Client("1231181189")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("client for an alias is blocked by another alias")
+	}
+}
@@ -0,0 +1,161 @@
+package swish
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Names of the secrets that are requested from a secret provider.
+const (
+	SecretP12        = "p12"
+	SecretPassphrase = "passphrase"
+	SecretCert       = "cert"
+	SecretKey        = "key"
+	SecretRoot       = "root"
+)
+
+var (
+	// ErrSecretNotFound is the error when a secret provider does not have the requested secret.
+	ErrSecretNotFound = errors.New("Error: Secret not found")
+)
+
+// SecretProvider represents a source of credentials such as Vault or a KMS.
+type SecretProvider interface {
+	// Secret returns the secret with the given name or ErrSecretNotFound.
+	Secret(name string) ([]byte, error)
+}
+
+// FileSecretProvider represents a secret provider that reads each secret from a file
+// with the secret's name in a directory, like mounted Kubernetes secrets.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret returns the content of the file with the given name.
+func (p *FileSecretProvider) Secret(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrSecretNotFound
+	}
+
+	return data, err
+}
+
+// OptionsFromEnv creates options from the following environment variables:
+//
+//	SWISH_ENV                             the Swish environment, test or production
+//	SWISH_P12 or SWISH_P12_BASE64         the P12 file or base64 encoded P12
+//	SWISH_CERT or SWISH_CERT_BASE64       the PEM certificate file or base64 encoded PEM certificate
+//	SWISH_KEY or SWISH_KEY_BASE64         the PEM key file or base64 encoded PEM key
+//	SWISH_PASSPHRASE                      the passphrase for the P12 or key
+//	SWISH_ROOT or SWISH_ROOT_BASE64       the root file or base64 encoded root
+func OptionsFromEnv() (*Options, error) {
+	opts := &Options{
+		Env:        os.Getenv("SWISH_ENV"),
+		P12:        os.Getenv("SWISH_P12"),
+		Cert:       os.Getenv("SWISH_CERT"),
+		Key:        os.Getenv("SWISH_KEY"),
+		Root:       os.Getenv("SWISH_ROOT"),
+		Passphrase: os.Getenv("SWISH_PASSPHRASE"),
+	}
+
+	for name, field := range map[string]*[]byte{
+		"SWISH_P12_BASE64":  &opts.P12Data,
+		"SWISH_CERT_BASE64": &opts.CertData,
+		"SWISH_KEY_BASE64":  &opts.KeyData,
+		"SWISH_ROOT_BASE64": &opts.RootData,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid base64 in %s: %s", name, err)
+		}
+
+		*field = data
+	}
+
+	return opts, nil
+}
+
+// resolveSecrets returns a copy of the given options where the credentials that are
+// not configured are read from the secret provider, if any.
+func resolveSecrets(opts *Options) (*Options, error) {
+	if opts.Secrets == nil {
+		return opts, nil
+	}
+
+	o := *opts
+
+	secret := func(name string, configured bool, field *[]byte) error {
+		if configured {
+			return nil
+		}
+
+		data, err := opts.Secrets.Secret(name)
+		if errors.Is(err, ErrSecretNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		*field = data
+
+		return nil
+	}
+
+	// Certificate secrets are only fetched when the certificate is loaded from the options,
+	// not from a certificate source or a loaded certificate.
+	if o.CertificateSource == nil && o.Certificate == nil {
+		hasP12 := o.P12 != "" || o.P12Data != nil
+		hasCert := o.Cert != "" || o.CertData != nil
+
+		if !hasP12 && !hasCert {
+			if err := secret(SecretP12, false, &o.P12Data); err != nil {
+				return nil, err
+			}
+
+			hasP12 = o.P12Data != nil
+		}
+
+		if !hasP12 && !hasCert {
+			if err := secret(SecretCert, false, &o.CertData); err != nil {
+				return nil, err
+			}
+
+			hasCert = o.CertData != nil
+		}
+
+		// The key is only used with a PEM certificate.
+		if hasCert {
+			if err := secret(SecretKey, o.Key != "" || o.KeyData != nil, &o.KeyData); err != nil {
+				return nil, err
+			}
+		}
+
+		if hasP12 || hasCert {
+			var passphrase []byte
+			if err := secret(SecretPassphrase, o.Passphrase != "", &passphrase); err != nil {
+				return nil, err
+			}
+
+			if passphrase != nil {
+				o.Passphrase = string(passphrase)
+			}
+		}
+	}
+
+	if err := secret(SecretRoot, o.Root != "" || o.RootData != nil, &o.RootData); err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
@@ -0,0 +1,132 @@
+package swish
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frozzare/go-assert"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	t.Setenv("SWISH_ENV", "test")
+	t.Setenv("SWISH_P12_BASE64", base64.StdEncoding.EncodeToString(p12))
+	t.Setenv("SWISH_PASSPHRASE", "swish")
+	t.Setenv("SWISH_ROOT", "./certs/root.pem")
+
+	opts, err := OptionsFromEnv()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "test", opts.Env)
+	assert.Equal(t, p12, opts.P12Data)
+	assert.Equal(t, "swish", opts.Passphrase)
+	assert.Equal(t, "./certs/root.pem", opts.Root)
+
+	_, err = NewClient(opts)
+	assert.Nil(t, err)
+
+	t.Setenv("SWISH_KEY_BASE64", "invalid")
+
+	_, err = OptionsFromEnv()
+	assert.NotNil(t, err)
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	p12, err := os.ReadFile("./certs/test.p12")
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, SecretP12), p12, 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, SecretPassphrase), []byte("swish"), 0600))
+
+	provider := &FileSecretProvider{Dir: dir}
+
+	_, err = provider.Secret(SecretRoot)
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	client, err := NewClient(&Options{
+		Env:     "test",
+		Secrets: provider,
+	})
+	assert.Nil(t, err)
+
+	info, err := client.CertificateInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, "1231181189", info.SwishNumber)
+
+	_, err = NewClient(&Options{
+		Env:     "test",
+		Secrets: &FileSecretProvider{Dir: t.TempDir()},
+	})
+	assert.NotNil(t, err)
+}
+
+// recordingSecretProvider is a secret provider that records the secrets it is asked for.
+type recordingSecretProvider struct {
+	names []string
+}
+
+// Secret records the name and returns ErrSecretNotFound.
+func (p *recordingSecretProvider) Secret(name string) ([]byte, error) {
+	p.names = append(p.names, name)
+	return nil, ErrSecretNotFound
+}
+
+func TestResolveSecretsOnlyUsedSecrets(t *testing.T) {
+	tests := []struct {
+		description string
+		options     *Options
+		expected    []string
+	}{
+		{
+			description: "certificate source",
+			options:     &Options{CertificateSource: NewMemoryCertificate(nil)},
+			expected:    []string{SecretRoot},
+		},
+		{
+			description: "p12",
+			options:     &Options{P12: "./certs/test.p12"},
+			expected:    []string{SecretPassphrase, SecretRoot},
+		},
+		{
+			description: "pem certificate",
+			options:     &Options{Cert: "cert.pem"},
+			expected:    []string{SecretKey, SecretPassphrase, SecretRoot},
+		},
+		{
+			description: "nothing configured",
+			options:     &Options{},
+			expected:    []string{SecretP12, SecretCert, SecretRoot},
+		},
+	}
+
+	for _, test := range tests {
+		provider := &recordingSecretProvider{}
+		test.options.Secrets = provider
+
+		_, err := resolveSecrets(test.options)
+		assert.Nil(t, err, test.description)
+		assert.Equal(t, test.expected, provider.names, test.description)
+	}
+}
+
+// wrappingSecretProvider is a secret provider that wraps ErrSecretNotFound like Vault or KMS clients.
+type wrappingSecretProvider struct{}
+
+// Secret returns a wrapped ErrSecretNotFound.
+func (wrappingSecretProvider) Secret(name string) ([]byte, error) {
+	return nil, fmt.Errorf("vault: secret %s: %w", name, ErrSecretNotFound)
+}
+
+func TestResolveSecretsWrappedNotFound(t *testing.T) {
+	opts, err := resolveSecrets(&Options{P12: "./certs/test.p12", Secrets: wrappingSecretProvider{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "./certs/test.p12", opts.P12)
+	assert.Equal(t, "", opts.Passphrase)
+	assert.Nil(t, opts.RootData)
+}
@@ -0,0 +1,215 @@
+package swish
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Types of payment requests that are stored.
+const (
+	TypePaymentRequest = "paymentrequest"
+	TypeRefund         = "refund"
+)
+
+// Statuses of payment requests and refunds from Swish API.
+const (
+	StatusCreated   = "CREATED"
+	StatusDebited   = "DEBITED"
+	StatusPaid      = "PAID"
+	StatusDeclined  = "DECLINED"
+	StatusError     = "ERROR"
+	StatusCancelled = "CANCELLED"
+)
+
+var (
+	// ErrNotFound is the error when a payment request does not exist in a store.
+	ErrNotFound = errors.New("Error: Payment request not found")
+)
+
+// StoreRecord represents a payment request or refund in a store.
+type StoreRecord struct {
+	Type    string          `json:"type"`
+	Request *PaymentRequest `json:"request"`
+	Created time.Time       `json:"created"`
+	Updated time.Time       `json:"updated"`
+}
+
+// Store represents a persistence for payment requests and refunds, updated by the client
+// when requests are created or fetched and by the callback handler.
+type Store interface {
+	// Save creates or updates the payment request or refund with the request's ID.
+	Save(ctx context.Context, typ string, req *PaymentRequest) error
+	// Get returns the payment request or refund with the given ID or ErrNotFound.
+	Get(ctx context.Context, id string) (*StoreRecord, error)
+	// Refunds returns the refunds with the given original payment reference.
+	Refunds(ctx context.Context, paymentReference string) ([]*StoreRecord, error)
+	// Pending returns the payment requests and refunds without a final status that were created before the given time.
+	Pending(ctx context.Context, createdBefore time.Time) ([]*StoreRecord, error)
+}
+
+// MemoryStore represents a store that keeps payment requests in memory.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*StoreRecord
+}
+
+// NewMemoryStore creates a new empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*StoreRecord),
+	}
+}
+
+// Save creates or updates the payment request or refund with the request's ID.
+func (s *MemoryStore) Save(ctx context.Context, typ string, req *PaymentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	r := *req
+
+	record, ok := s.records[req.ID]
+	if !ok {
+		record = &StoreRecord{Created: now}
+		s.records[req.ID] = record
+	}
+
+	record.Type = typ
+	record.Request = &r
+	record.Updated = now
+
+	return nil
+}
+
+// Get returns the payment request or refund with the given ID or ErrNotFound.
+func (s *MemoryStore) Get(ctx context.Context, id string) (*StoreRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyRecord(record), nil
+}
+
+// Refunds returns the refunds with the given original payment reference.
+func (s *MemoryStore) Refunds(ctx context.Context, paymentReference string) ([]*StoreRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var refunds []*StoreRecord
+	for _, record := range s.records {
+		if record.Type == TypeRefund && record.Request.OriginalPaymentReference == paymentReference {
+			refunds = append(refunds, copyRecord(record))
+		}
+	}
+
+	sort.Slice(refunds, func(i, j int) bool {
+		return refunds[i].Created.Before(refunds[j].Created)
+	})
+
+	return refunds, nil
+}
+
+// Pending returns the payment requests and refunds without a final status that were created before the given time.
+func (s *MemoryStore) Pending(ctx context.Context, createdBefore time.Time) ([]*StoreRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pending []*StoreRecord
+	for _, record := range s.records {
+		if !finalStatus(record.Request.Status) && record.Created.Before(createdBefore) {
+			pending = append(pending, copyRecord(record))
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Created.Before(pending[j].Created)
+	})
+
+	return pending, nil
+}
+
+// RefundableAmount returns the amount that is left to refund for the paid payment request with the
+// given ID, which is the paid amount minus the amount of the refunds that have not failed.
+func RefundableAmount(ctx context.Context, store Store, id string) (string, error) {
+	record, err := store.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	refundable, err := refundableAmount(ctx, store, record.Request)
+	if err != nil {
+		return "", err
+	}
+
+	return formatAmount(refundable), nil
+}
+
+// refundableAmount returns the amount in öre that is left to refund for the given payment request.
+func refundableAmount(ctx context.Context, store Store, req *PaymentRequest) (int64, error) {
+	if req.Status != StatusPaid {
+		return 0, nil
+	}
+
+	refundable, err := parseAmount(req.Amount)
+	if err != nil {
+		return 0, err
+	}
+
+	refunds, err := store.Refunds(ctx, req.PaymentReference)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, refund := range refunds {
+		if refund.Request.Status == StatusError || refund.Request.Status == StatusDeclined {
+			continue
+		}
+
+		amount, err := parseAmount(refund.Request.Amount)
+		if err != nil {
+			return 0, err
+		}
+
+		refundable -= amount
+	}
+
+	return refundable, nil
+}
+
+// finalStatus returns true if the given status will not change.
+func finalStatus(status string) bool {
+	switch status {
+	case StatusPaid, StatusDeclined, StatusError, StatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// save saves the given payment request or refund in the store, if any. Failures are
+// logged since the request has already been sent to Swish.
+func (c *Client) save(ctx context.Context, typ string, req *PaymentRequest) {
+	if c.Store == nil || req == nil {
+		return
+	}
+
+	if err := c.Store.Save(ctx, typ, req); err != nil {
+		logf(ctx, "failed to save %s %s: %s", typ, req.ID, err)
+	}
+}
+
+// copyRecord returns a copy of the given record.
+func copyRecord(record *StoreRecord) *StoreRecord {
+	r := *record
+	req := *record.Request
+	r.Request = &req
+
+	return &r
+}
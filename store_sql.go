@@ -0,0 +1,149 @@
+package swish
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SQLStore represents a store that keeps payment requests in a SQL database using
+// SQLite syntax, for example with SQLite through database/sql.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore creates a new SQL store that uses the given table, swish_payments when empty.
+// The table is created with CreateTable.
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+	if table == "" {
+		table = "swish_payments"
+	}
+
+	return &SQLStore{
+		db:    db,
+		table: table,
+	}
+}
+
+// CreateTable creates the store's table if it does not exist.
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		payment_reference TEXT NOT NULL,
+		original_payment_reference TEXT NOT NULL,
+		data TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`, s.table))
+
+	return err
+}
+
+// Save creates or updates the payment request or refund with the request's ID.
+func (s *SQLStore) Save(ctx context.Context, typ string, req *PaymentRequest) error {
+	return s.save(ctx, s.db, typ, req)
+}
+
+// SaveTx creates or updates the payment request or refund with the request's ID within the given transaction.
+func (s *SQLStore) SaveTx(ctx context.Context, tx *sql.Tx, typ string, req *PaymentRequest) error {
+	return s.save(ctx, tx, typ, req)
+}
+
+// save creates or updates the payment request or refund with the given executor.
+func (s *SQLStore) save(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, typ string, req *PaymentRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+		(id, type, status, payment_reference, original_payment_reference, data, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			type = excluded.type,
+			status = excluded.status,
+			payment_reference = excluded.payment_reference,
+			original_payment_reference = excluded.original_payment_reference,
+			data = excluded.data,
+			updated_at = excluded.updated_at`, s.table),
+		req.ID, typ, req.Status, req.PaymentReference, req.OriginalPaymentReference, string(data), now, now)
+
+	return err
+}
+
+// Get returns the payment request or refund with the given ID or ErrNotFound.
+func (s *SQLStore) Get(ctx context.Context, id string) (*StoreRecord, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT type, data, created_at, updated_at FROM %s WHERE id = ?`, s.table), id)
+
+	record, err := scanRecord(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return record, err
+}
+
+// Refunds returns the refunds with the given original payment reference.
+func (s *SQLStore) Refunds(ctx context.Context, paymentReference string) ([]*StoreRecord, error) {
+	return s.query(ctx, fmt.Sprintf(`SELECT type, data, created_at, updated_at FROM %s
+		WHERE type = ? AND original_payment_reference = ? ORDER BY created_at`, s.table),
+		TypeRefund, paymentReference)
+}
+
+// Pending returns the payment requests and refunds without a final status that were created before the given time.
+func (s *SQLStore) Pending(ctx context.Context, createdBefore time.Time) ([]*StoreRecord, error) {
+	return s.query(ctx, fmt.Sprintf(`SELECT type, data, created_at, updated_at FROM %s
+		WHERE status NOT IN (?, ?, ?, ?) AND created_at < ? ORDER BY created_at`, s.table),
+		StatusPaid, StatusDeclined, StatusError, StatusCancelled, createdBefore.UnixNano())
+}
+
+// query returns the records from the given query.
+func (s *SQLStore) query(ctx context.Context, query string, args ...interface{}) ([]*StoreRecord, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var records []*StoreRecord
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// scanRecord scans a record from the given row.
+func scanRecord(row interface{ Scan(...interface{}) error }) (*StoreRecord, error) {
+	var record StoreRecord
+	var data string
+	var created, updated int64
+
+	if err := row.Scan(&record.Type, &data, &created, &updated); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &record.Request); err != nil {
+		return nil, err
+	}
+
+	record.Created = time.Unix(0, created)
+	record.Updated = time.Unix(0, updated)
+
+	return &record, nil
+}
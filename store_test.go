@@ -0,0 +1,128 @@
+package swish
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+	_ "modernc.org/sqlite"
+)
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, store.Save(ctx, TypePaymentRequest, &PaymentRequest{
+		ID:     "AB23D7406ECE4542A80152D909EF9F6B",
+		Amount: "100.00",
+		Status: StatusCreated,
+	}))
+
+	assert.Nil(t, store.Save(ctx, TypePaymentRequest, &PaymentRequest{
+		ID:               "AB23D7406ECE4542A80152D909EF9F6B",
+		PaymentReference: "6D6CD7406ECE4542A80152D909EF9F6B",
+		Amount:           "100.00",
+		Status:           StatusPaid,
+	}))
+
+	record, err := store.Get(ctx, "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+	assert.Equal(t, TypePaymentRequest, record.Type)
+	assert.Equal(t, StatusPaid, record.Request.Status)
+	assert.False(t, record.Updated.Before(record.Created))
+
+	for id, refund := range map[string]*PaymentRequest{
+		"1": {Amount: "20.50", Status: StatusPaid},
+		"2": {Amount: "30", Status: StatusCreated},
+		"3": {Amount: "40", Status: StatusError},
+	} {
+		refund.ID = id
+		refund.OriginalPaymentReference = "6D6CD7406ECE4542A80152D909EF9F6B"
+
+		assert.Nil(t, store.Save(ctx, TypeRefund, refund))
+	}
+
+	refunds, err := store.Refunds(ctx, "6D6CD7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(refunds))
+
+	amount, err := RefundableAmount(ctx, store, "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+	assert.Equal(t, "49.50", amount)
+
+	pending, err := store.Pending(ctx, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, "2", pending[0].Request.ID)
+
+	pending, err = store.Pending(ctx, time.Now().Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pending))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+
+	defer db.Close()
+
+	store := NewSQLStore(db, "")
+	assert.Nil(t, store.CreateTable(context.Background()))
+
+	testStore(t, store)
+}
+
+func TestClientStore(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	store := NewMemoryStore()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Store:      store,
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(201, "")
+
+		resp.Header.Set("Location", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B")
+
+		return resp, nil
+	})
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, `{"id":"AB23D7406ECE4542A80152D909EF9F6B","amount":"100","status":"PAID"}`), nil
+	})
+
+	res, err := client.CreatePaymentRequest(context.Background(), &PaymentRequest{Amount: "100"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", res.Status)
+
+	record, err := store.Get(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusCreated, record.Request.Status)
+
+	_, err = client.PaymentRequest(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+
+	record, err = store.Get(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPaid, record.Request.Status)
+}
@@ -0,0 +1,63 @@
+package swish
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default timeouts of the http client and transport created by NewClient. They are used
+// when the configured http client or transport has no timeout of its own.
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultTimeout               = 60 * time.Second
+)
+
+// Timeouts represents timeouts for operations. Each timeout is layered onto the caller's
+// context, so the earliest deadline applies. A zero timeout leaves the caller's context as it is.
+type Timeouts struct {
+	CreatePaymentRequest time.Duration
+	PaymentRequest       time.Duration
+	CancelPaymentRequest time.Duration
+	CreateRefundRequest  time.Duration
+	RefundRequest        time.Duration
+}
+
+// withTimeout returns a context with the given timeout, or the context as it is for a zero timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// setDefaultTimeouts sets the default timeouts that are not configured on the given http
+// client and transport. The dialer is only replaced on a transport without one.
+func setDefaultTimeouts(client *http.Client, t *http.Transport) {
+	if client.Timeout == 0 {
+		client.Timeout = DefaultTimeout
+	}
+
+	if t == nil {
+		return
+	}
+
+	if t.DialContext == nil && t.Dial == nil {
+		t.DialContext = (&net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	if t.TLSHandshakeTimeout == 0 {
+		t.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+
+	if t.ResponseHeaderTimeout == 0 {
+		t.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	}
+}
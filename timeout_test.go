@@ -0,0 +1,70 @@
+package swish
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/frozzare/go-assert"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestCreateHTTPClientTimeouts(t *testing.T) {
+	client := createHTTPClient(nil, nil)
+	assert.Equal(t, DefaultTimeout, client.Timeout)
+
+	transport := client.Transport.(*http.Transport)
+	assert.NotNil(t, transport.DialContext)
+	assert.Equal(t, DefaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.Equal(t, DefaultResponseHeaderTimeout, transport.ResponseHeaderTimeout)
+
+	client = createHTTPClient(&http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{ResponseHeaderTimeout: time.Second},
+	}, nil)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+
+	transport = client.Transport.(*http.Transport)
+	assert.Equal(t, time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, DefaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+}
+
+func TestOperationTimeouts(t *testing.T) {
+	httpmock.Activate()
+
+	defer httpmock.DeactivateAndReset()
+
+	client, err := NewClient(&Options{
+		Env:        "test",
+		Passphrase: "swish",
+		P12:        "./certs/test.p12",
+		Root:       "./certs/root.pem",
+		Timeouts: Timeouts{
+			PaymentRequest: 10 * time.Millisecond,
+		},
+	})
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/paymentrequests/AB23D7406ECE4542A80152D909EF9F6B", func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(time.Second):
+			return httpmock.NewStringResponse(200, `{"id":"AB23D7406ECE4542A80152D909EF9F6B"}`), nil
+		}
+	})
+
+	httpmock.RegisterResponder("GET", "https://mss.cpc.getswish.net/swish-cpcapi/api/v1/refunds/ABC", httpmock.NewStringResponder(200, `{"id":"ABC"}`))
+
+	start := time.Now()
+
+	_, err = client.PaymentRequest(context.Background(), "AB23D7406ECE4542A80152D909EF9F6B")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	refund, err := client.RefundRequest(context.Background(), "ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, "ABC", refund.ID)
+}